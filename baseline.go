@@ -0,0 +1,62 @@
+package makoto
+
+import (
+	"context"
+	"database/sql"
+	"log"
+)
+
+// Baseline marks every script up to and including version as applied without
+// running it, for databases whose schema existed before adopting makoto. The
+// records are written with StatusBaseline so audits can tell them apart. It
+// fails with ErrHistoryNotEmpty once any migration is applied.
+func (m *Migrator) Baseline(version int) error {
+	return m.BaselineContext(context.Background(), version)
+}
+
+// BaselineContext is like Baseline but runs every database call with ctx.
+func (m *Migrator) BaselineContext(ctx context.Context, version int) error {
+	return m.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		return m.baseline(ctx, conn, version)
+	})
+}
+
+func (m *Migrator) baseline(ctx context.Context, conn *sql.Conn, version int) error {
+	collection, err := m.Collection()
+	if err != nil {
+		return err
+	}
+	if collection.Find(version) == nil {
+		return ErrTargetVersionNotFound
+	}
+
+	if err := m.checkDirty(ctx, conn); err != nil {
+		return err
+	}
+	h, err := m.loadHistory(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if h.latest() != 0 {
+		return ErrHistoryNotEmpty
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for item := collection.Head(); item != nil; item = item.Next() {
+		st := item.Statement()
+		if st.Version > version {
+			break
+		}
+		if _, err := addRecord(ctx, m.dialect, tx, st.Version, st.Filename, st.Checksum, ExecUP, "", StatusBaseline); err != nil {
+			return err
+		}
+	}
+
+	log.Println("Baseline schema version: ", version)
+	return tx.Commit()
+}
@@ -70,6 +70,15 @@ func getSQLScriptDir() string {
 	return ""
 }
 
+func getSeedDir() string {
+	fullPath := filepath.Join(getMigrationDir(), seedDir)
+	if exists(fullPath) {
+		return fullPath
+	}
+	log.Fatal("Unknow seed script directory")
+	return ""
+}
+
 func getMigrationDir() string {
 	dir := currentDir()
 	if strings.HasSuffix(dir, migrationDir) {
@@ -98,8 +107,13 @@ func createNewScript(name string, useSequence bool) {
 		version = getNewScriptSequence()
 	}
 
-	filename := fmt.Sprintf("%v_%s.sql", version, name)
+	// a name with directories creates the script in those subdirectories
+	subdir, name := filepath.Split(name)
+	filename := filepath.Join(subdir, fmt.Sprintf("%v_%s.sql", version, name))
 	fullPath := filepath.Join(dir, filename)
+	if err := os.MkdirAll(filepath.Dir(fullPath), os.ModePerm); err != nil {
+		log.Fatal(err)
+	}
 	log.Println("Create new migration script: ", filename)
 	os.Create(fullPath)
 }
@@ -116,6 +130,6 @@ func getNewScriptSequence() string {
 // func displayMigrati
 
 func initCollection() *makoto.MigrationCollection {
-	dir := getMigrationDir()
+	dir := getSQLScriptDir()
 	return processMigrationCollection(dir)
 }
@@ -1,6 +1,8 @@
 package main
 
 type dbConfig struct {
+	// sql dialect of the database, postgres by default
+	Dialect  string   `toml:"dialect"`
 	Postgres postgres `toml:"postgres"`
 }
 
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/stanlry/makoto"
+)
+
+// Connect opens the database of the uri with the dialect of its scheme,
+// postgres://, cockroach://, mysql:// or sqlite://. A uri without scheme is a
+// postgres connection string.
+func Connect(uri string) (*sql.DB, makoto.Dialect, error) {
+	scheme := ""
+	if i := strings.Index(uri, "://"); i >= 0 {
+		scheme = uri[:i]
+	}
+
+	switch scheme {
+	case "mysql", "mariadb":
+		con, err := connectMySQL(uri)
+		return con, makoto.MySQL, err
+	case "sqlite", "sqlite3":
+		con, err := connectSQLite(uri)
+		return con, makoto.SQLite, err
+	case "cockroach", "cockroachdb":
+		// CockroachDB speaks the postgres protocol
+		con, err := sql.Open("postgres", "postgres"+uri[len(scheme):])
+		return con, makoto.Cockroach, err
+	case "", "postgres", "postgresql":
+		con, err := sql.Open("postgres", uri)
+		return con, makoto.Postgres, err
+	default:
+		_, err := makoto.GetDialect(scheme)
+		return nil, nil, err
+	}
+}
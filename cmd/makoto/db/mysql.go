@@ -0,0 +1,36 @@
+package db
+
+import (
+	"database/sql"
+	"net/url"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// connectMySQL opens mysql://[user]:[password]@[host]:3306/[dbname]?[params].
+// Migration scripts have several statements and the history is scanned into
+// time.Time, so multiStatements and parseTime are always on.
+func connectMySQL(uri string) (*sql.DB, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	config := mysql.NewConfig()
+	config.User = u.User.Username()
+	config.Passwd, _ = u.User.Password()
+	config.Net = "tcp"
+	config.Addr = u.Host
+	config.DBName = u.Path
+	if len(config.DBName) > 0 && config.DBName[0] == '/' {
+		config.DBName = config.DBName[1:]
+	}
+	config.Params = map[string]string{}
+	for key, values := range u.Query() {
+		config.Params[key] = values[len(values)-1]
+	}
+	config.MultiStatements = true
+	config.ParseTime = true
+
+	return sql.Open("mysql", config.FormatDSN())
+}
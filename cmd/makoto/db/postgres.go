@@ -6,6 +6,7 @@ import (
 	_ "github.com/lib/pq"
 )
 
+// Deprecated: use Connect, which selects the dialect from the uri scheme.
 func ConnectPostgres(uri string) *sql.DB {
 	con, err := sql.Open("postgres", uri)
 	if err != nil {
@@ -0,0 +1,21 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// connectSQLite opens sqlite://[path], e.g. sqlite://./dev.db or
+// sqlite:///var/lib/app.db. Foreign keys are enforced and a busy database is
+// retried for 5 seconds, other processes and connections of the pool may be
+// writing to the file, e.g. a migrator waiting for the lock.
+func connectSQLite(uri string) (*sql.DB, error) {
+	path := uri[strings.Index(uri, "://")+3:]
+	params := "_foreign_keys=on&_busy_timeout=5000"
+	if strings.Contains(path, "?") {
+		return sql.Open("sqlite3", "file:"+path+"&"+params)
+	}
+	return sql.Open("sqlite3", "file:"+path+"?"+params)
+}
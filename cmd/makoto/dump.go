@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/stanlry/makoto"
+)
+
+// dumpSchemaPath is set by migrate --dump-schema
+var dumpSchemaPath string
+
+// dumpSchema writes the schema of the database to path, or to stdout when
+// path is empty.
+func dumpSchema(ctx context.Context, migrator *makoto.Migrator, path string) error {
+	buffer := bytes.NewBuffer(nil)
+	if err := migrator.DumpSchemaContext(ctx, buffer); err != nil {
+		return err
+	}
+
+	if path == "" {
+		_, err := os.Stdout.Write(buffer.Bytes())
+		return err
+	}
+	if err := ioutil.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+		return err
+	}
+	log.Println("Dumped schema: ", path)
+	return nil
+}
+
+// withSchemaDump dumps the schema to --dump-schema once fn migrated
+// successfully.
+func withSchemaDump(ctx context.Context, migrator *makoto.Migrator, fn func() error) func() error {
+	if dumpSchemaPath == "" {
+		return fn
+	}
+	return func() error {
+		if err := fn(); err != nil {
+			return err
+		}
+		return dumpSchema(ctx, migrator, dumpSchemaPath)
+	}
+}
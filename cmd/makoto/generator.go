@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+
+	"github.com/stanlry/makoto"
 )
 
 const collectionFilename = "pack.go"
@@ -17,7 +19,11 @@ func GenerateStringCollection(path string) {
 	fmt.Fprint(buffer, `// Code generated by makoto cli, DO NOT EDIT.
 package migration
 
-import "github.com/stanlry/makoto"
+import (
+	"database/sql"
+
+	"github.com/stanlry/makoto"
+)
 
 func New(db *sql.DB) *makoto.Migrator {
 	m := makoto.New(db)
@@ -25,36 +31,34 @@ func New(db *sql.DB) *makoto.Migrator {
 	return m
 }
 
-func getCollection() makoto.MigrateCollection {
+func getCollection() *makoto.MigrationCollection {
 	statements := []makoto.MigrateStatement{
 	`)
 
 	collection := processMigrationCollection(path)
-	migration := collection.Head()
-	for {
-		st := migration.Statement()
+	statements := []*makoto.MigrateStatement{}
+	for migration := collection.Head(); migration != nil; migration = migration.Next() {
+		statements = append(statements, migration.Statement())
+	}
+	statements = append(statements, collection.Repeatables()...)
+
+	for _, st := range statements {
 		upSt, _ := json.Marshal(st.UpStatement)
 		downSt, _ := json.Marshal(st.DownStatement)
 
 		fmt.Fprintf(buffer, `
-		{"%v", "%v", %v, %v, "%v"},
-		`, st.Version, st.Filename, string(upSt), string(downSt), st.Checksum)
+		{Version: %v, Filename: "%v", UpStatement: %v, DownStatement: %v, Checksum: "%v", NoTransaction: %v, Repeatable: %v, Squash: %v},
+		`, st.Version, st.Filename, string(upSt), string(downSt), st.Checksum, st.NoTransaction, st.Repeatable, st.Squash)
 
 		fmt.Printf("%v\n", st.Filename)
-
-		if migration.Next() != nil {
-			migration = migration.Next()
-			continue
-		}
-		break
 	}
 
 	fmt.Fprint(buffer, `
 	}
 
 	collection := makoto.MigrationCollection{}
-	for _, st := range statements {
-		collection.Add(statement)
+	for i := range statements {
+		collection.Add(&statements[i])
 	}
 	return &collection
 }`)
@@ -79,12 +83,14 @@ import (
 	"github.com/stanlry/makoto"
 )
 
-//go:embed sql/*.sql
+//go:embed sql
 var collection embed.FS
 
 func New(db *sql.DB) *makoto.Migrator {
 	m := makoto.New(db)
-	m.SetEmbedCollection(collection)
+	if err := m.SetFSCollection(collection, "sql"); err != nil {
+		panic(err)
+	}
 	return m
 }
 
@@ -2,13 +2,17 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/BurntSushi/toml"
@@ -21,8 +25,11 @@ import (
 const keyMigrator = "migrator"
 
 var (
-	database   string
-	configPath string
+	database string
+	// set by the dialect of the config
+	dialectName string
+	configPath  string
+	output      string
 )
 
 func main() {
@@ -30,7 +37,7 @@ func main() {
 	app := cli.NewApp()
 	app.Name = "makoto"
 	app.Version = makoto.VERSION
-	app.Usage = "minimalist migration tool for PostgreSQL"
+	app.Usage = "minimalist migration tool for PostgreSQL, MySQL and SQLite"
 	app.Flags = []cli.Flag{
 		&cli.StringFlag{
 			Name:        "database",
@@ -42,6 +49,15 @@ func main() {
 			Usage:       "Specify config path",
 			Destination: &configPath,
 		},
+		&cli.StringFlag{
+			Name:        "output",
+			Usage:       "Output format of list, status, validate and migrate: table, json or yaml",
+			Value:       outputTable,
+			Destination: &output,
+		},
+	}
+	app.Before = func(c *cli.Context) error {
+		return checkOutput()
 	}
 
 	app.Commands = []*cli.Command{
@@ -103,56 +119,234 @@ func main() {
 			Name:  "list",
 			Usage: "List existing sql migration scripts in the directory",
 			Action: func(c *cli.Context) error {
-				table := tablewriter.NewWriter(os.Stdout)
-				table.SetHeader([]string{"Version", "Script Name"})
-
 				collection := processMigrationCollection(getSQLScriptDir())
-				item := collection.Head()
-				for {
-					if item == nil {
-						break
+				return render(newListOutput(collection), func() {
+					table := tablewriter.NewWriter(os.Stdout)
+					table.SetHeader([]string{"Version", "Script Name"})
+
+					item := collection.Head()
+					for {
+						if item == nil {
+							break
+						}
+						if item.Statement() == nil {
+							break
+						}
+						table.Append([]string{strconv.Itoa(item.Statement().Version), item.Statement().Filename})
+						item = item.Next()
 					}
-					if item.Statement() == nil {
-						break
+					for _, st := range collection.Repeatables() {
+						table.Append([]string{"R", st.Filename})
 					}
-					table.Append([]string{strconv.Itoa(item.Statement().Version), item.Statement().Filename})
-					item = item.Next()
-				}
-				table.Render()
-				return nil
+					table.Render()
+				})
 			},
 		},
 		{
 			Name:  "status",
-			Usage: "Return the migration table from database",
+			Usage: "Return the state of every migration, applied or pending",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "history",
+					Usage: "Return every record of the migration table instead",
+				},
+			},
 			Action: func(c *cli.Context) error {
-				configureDBUri()
-				db := db.ConnectPostgres(database)
-				defer db.Close()
-				r, err := makoto.GetAllRecords(db)
+				if c.Bool("history") {
+					return printHistory(c)
+				}
+
+				migrator := newMigrator()
+				defer migrator.Close()
+				status, err := migrator.StatusContext(c.Context)
 				if err != nil {
-					panic(err)
+					return err
 				}
 
-				table := tablewriter.NewWriter(os.Stdout)
-				table.SetHeader([]string{"Version", "Execution Type", "Script", "Create Date"})
-				for _, record := range r {
-					date := record.CreatedAt.Format(time.RFC3339)
-					table.Append([]string{strconv.Itoa(record.Version), record.Exectype, record.Filename, date})
+				return render(newStatusOutput(status), func() {
+					table := tablewriter.NewWriter(os.Stdout)
+					table.SetHeader([]string{"Version", "Script", "State", "Applied Date", "Checksum"})
+					for _, ms := range status.Migrations {
+						version, date, checksum := strconv.Itoa(ms.Version), "", ""
+						if ms.Repeatable {
+							version = "R"
+						}
+						if ms.Applied && !ms.Missing {
+							date, checksum = ms.AppliedAt.Format(time.RFC3339), "ok"
+						}
+						if !ms.ChecksumMatch {
+							checksum = "changed"
+						}
+						table.Append([]string{version, ms.Filename, statusState(ms), date, checksum})
+					}
+					table.Render()
+
+					if status.Dirty {
+						fmt.Println("Database is dirty, fix it by hand and run force")
+					}
+				})
+			},
+		},
+		{
+			Name:  "validate",
+			Usage: "Check applied migrations against the sql migration scripts",
+			Action: func(c *cli.Context) error {
+				migrator := newMigrator()
+				defer migrator.Close()
+
+				drifts, err := migrator.ValidateContext(c.Context)
+				if err != nil {
+					return err
+				}
+
+				err = render(newValidateOutput(drifts), func() {
+					if len(drifts) == 0 {
+						fmt.Println("No drift detected")
+						return
+					}
+
+					table := tablewriter.NewWriter(os.Stdout)
+					table.SetHeader([]string{"Version", "Script", "Problem"})
+					for _, d := range drifts {
+						table.Append([]string{strconv.Itoa(d.Version), d.Filename, string(d.Kind)})
+					}
+					table.Render()
+				})
+				if err != nil {
+					return err
+				}
+				if len(drifts) > 0 {
+					return cli.Exit(fmt.Sprintf("%d migration(s) drifted", len(drifts)), 1)
 				}
-				table.Render()
 				return nil
 			},
 		},
+		{
+			Name:  "seed",
+			Usage: "Run the seed scripts of an environment that have not run yet",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "env",
+					Usage:    "Seed environment, the sub directory of migration/seed",
+					Required: true,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				migrator := newMigrator()
+				defer migrator.Close()
+				return migrator.Seed(c.Context, os.DirFS(getSeedDir()), c.String("env"))
+			},
+		},
+		{
+			Name:  "baseline",
+			Usage: "Mark the scripts up to a version as applied on a database whose schema already exists",
+			Flags: []cli.Flag{
+				&cli.IntFlag{
+					Name:     "version",
+					Usage:    "Specify the migration version the existing schema matches",
+					Required: true,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				migrator := newMigrator()
+				defer migrator.Close()
+				return migrator.BaselineContext(c.Context, c.Int("version"))
+			},
+		},
+		{
+			Name:  "squash",
+			Usage: "Replace the scripts up to a version with a single script and archive them",
+			Flags: []cli.Flag{
+				&cli.IntFlag{
+					Name:     "upto",
+					Usage:    "Specify the last migration version to squash",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:  "scratch-database",
+					Usage: "Build the script from pg_dump of this empty database instead of concatenating the scripts",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return squash(c.Context, c.Int("upto"), c.String("scratch-database"))
+			},
+		},
+		{
+			Name:  "force",
+			Usage: "Mark the database as migrated to a version without running scripts, to resolve a dirty state",
+			Flags: []cli.Flag{
+				&cli.IntFlag{
+					Name:     "version",
+					Usage:    "Specify the migration version the database is at, 0 for none",
+					Required: true,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				migrator := newMigrator()
+				defer migrator.Close()
+				return migrator.ForceContext(c.Context, c.Int("version"))
+			},
+		},
+		{
+			Name:  "dump",
+			Usage: "Write the schema of the database as sorted DDL",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "file",
+					Usage: "Write the schema to this path instead of stdout",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				migrator := newMigrator()
+				defer migrator.Close()
+				return dumpSchema(c.Context, migrator, c.String("file"))
+			},
+		},
 		{
 			Name:  "migrate",
 			Usage: "Run migration scripts",
+			Flags: []cli.Flag{
+				&cli.DurationFlag{
+					Name:  "lock-timeout",
+					Usage: "How long to wait for other migrations to release the lock, 0 waits forever",
+					Value: makoto.DefaultLockTimeout,
+				},
+				&cli.DurationFlag{
+					Name:  "lock-lease",
+					Usage: "How long the schema_lock row of CockroachDB and SQLite is held before it is treated as left behind, 0 never breaks it",
+					Value: makoto.DefaultLockLease,
+				},
+				&cli.StringFlag{
+					Name:  "tx-mode",
+					Usage: "Run pending scripts in one transaction (all), one transaction per script (each) or without transaction (none)",
+					Value: string(makoto.TxModeAll),
+				},
+				&cli.BoolFlag{
+					Name:  "allow-out-of-order",
+					Usage: "Apply pending scripts older than the latest applied one",
+				},
+				&cli.BoolFlag{
+					Name:  "ignore-drift",
+					Usage: "Run even if applied scripts were edited, removed or skipped",
+				},
+				&cli.StringFlag{
+					Name:        "dump-schema",
+					Usage:       "Write the schema of the database to this path after migrating",
+					Destination: &dumpSchemaPath,
+				},
+			},
 			Before: func(ctx *cli.Context) error {
-				configureDBUri()
-				db := db.ConnectPostgres(database)
-				collection := processMigrationCollection(getSQLScriptDir())
-				migrator := makoto.GetMigrator(db, collection)
-				migrator.SetCollection(collection)
+				txMode, err := makoto.ParseTxMode(ctx.String("tx-mode"))
+				if err != nil {
+					return err
+				}
+
+				migrator := newMigrator()
+				migrator.SetTxMode(txMode)
+				migrator.SetLockTimeout(ctx.Duration("lock-timeout"))
+				migrator.SetLockLease(ctx.Duration("lock-lease"))
+				migrator.SetIgnoreDrift(ctx.Bool("ignore-drift"))
+				migrator.SetAllowOutOfOrder(ctx.Bool("allow-out-of-order"))
 
 				ctx.Context = context.WithValue(ctx.Context, keyMigrator, migrator)
 				return nil
@@ -166,10 +360,19 @@ func main() {
 				{
 					Name:  "drop",
 					Usage: "drop all migrations",
+					Flags: []cli.Flag{dryRunFlag},
 					Action: func(ctx *cli.Context) error {
 						migrator := ctx.Context.Value(keyMigrator).(*makoto.Migrator)
-						migrator.DropAll()
-						return nil
+						if ctx.Bool("dry-run") {
+							steps, err := migrator.PlanDropContext(ctx.Context)
+							if err != nil {
+								return err
+							}
+							return printSteps(steps)
+						}
+						return reportMigration(ctx.Context, migrator, func() error {
+							return migrator.DropAllContext(ctx.Context)
+						})
 					},
 				},
 				{
@@ -180,16 +383,37 @@ func main() {
 							Name:  "version",
 							Usage: "Specify the migration version",
 						},
+						&cli.IntFlag{
+							Name:  "steps",
+							Usage: "Number of scripts to migrate up",
+						},
+						dryRunFlag,
 					},
 					Action: func(ctx *cli.Context) error {
 						migrator := ctx.Context.Value(keyMigrator).(*makoto.Migrator)
 						version := ctx.Int("version")
-						if version == 0 {
-							migrator.EnsureHead()
-						} else {
-							migrator.EnsureSchema(version)
+						if ctx.IsSet("steps") {
+							if ctx.IsSet("version") {
+								return errVersionAndSteps
+							}
+							return runSteps(ctx, migrator, makoto.ExecUP)
+						}
+						if ctx.Bool("dry-run") && version == 0 {
+							steps, err := migrator.PlanHeadContext(ctx.Context)
+							if err != nil {
+								return err
+							}
+							return printSteps(steps)
+						}
+						if ctx.Bool("dry-run") {
+							return printPlan(ctx.Context, migrator, version, makoto.ExecUP)
 						}
-						return nil
+						return reportMigration(ctx.Context, migrator, func() error {
+							if version == 0 {
+								return migrator.EnsureHeadContext(ctx.Context)
+							}
+							return migrator.EnsureSchemaContext(ctx.Context, version)
+						})
 					},
 				},
 				{
@@ -197,23 +421,104 @@ func main() {
 					Usage: "migrate down",
 					Flags: []cli.Flag{
 						&cli.IntFlag{
-							Name:     "version",
-							Usage:    "Specify the migration version",
-							Required: true,
+							Name:  "version",
+							Usage: "Specify the migration version",
+						},
+						&cli.IntFlag{
+							Name:  "steps",
+							Usage: "Number of scripts to migrate down",
 						},
+						dryRunFlag,
 					},
 					Action: func(ctx *cli.Context) error {
 						migrator := ctx.Context.Value(keyMigrator).(*makoto.Migrator)
 						version := ctx.Int("version")
-						migrator.Down(version)
-						return nil
+						if ctx.IsSet("steps") {
+							if ctx.IsSet("version") {
+								return errVersionAndSteps
+							}
+							return runSteps(ctx, migrator, makoto.ExecDOWN)
+						}
+						if !ctx.IsSet("version") {
+							return errors.New("missing --version or --steps")
+						}
+						if ctx.Bool("dry-run") {
+							return printPlan(ctx.Context, migrator, version, makoto.ExecDOWN)
+						}
+						return reportMigration(ctx.Context, migrator, func() error {
+							return migrator.DownContext(ctx.Context, version)
+						})
+					},
+				},
+				{
+					Name:  "redo",
+					Usage: "migrate down and up again",
+					Flags: []cli.Flag{
+						&cli.IntFlag{
+							Name:  "steps",
+							Usage: "Number of latest scripts to redo",
+							Value: 1,
+						},
+					},
+					Action: func(ctx *cli.Context) error {
+						migrator := ctx.Context.Value(keyMigrator).(*makoto.Migrator)
+						return reportMigration(ctx.Context, migrator, func() error {
+							return migrator.RedoContext(ctx.Context, ctx.Int("steps"))
+						})
 					},
 				},
 			},
 		},
 	}
 
-	app.Run(os.Args)
+	// cancel running migrations on interrupt so the transaction is rolled back
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := app.RunContext(ctx, os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func printHistory(c *cli.Context) error {
+	configureDBUri()
+	db, _ := connect(database)
+	defer db.Close()
+	r, err := makoto.GetAllRecordsContext(c.Context, db)
+	if err != nil {
+		return err
+	}
+
+	return render(newHistoryOutput(r), func() {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Version", "Execution Type", "Script", "Status", "Error", "Create Date"})
+		for _, record := range r {
+			date := record.CreatedAt.Format(time.RFC3339)
+			table.Append([]string{strconv.Itoa(record.Version), record.Exectype, record.Filename, record.Status, record.Error, date})
+		}
+		table.Render()
+	})
+}
+
+func newMigrator() *makoto.Migrator {
+	configureDBUri()
+	db, dialect := connect(database)
+	collection := processMigrationCollection(getSQLScriptDir())
+	migrator := makoto.GetMigrator(db, collection)
+	migrator.SetDialect(dialect)
+	return migrator
+}
+
+// connect opens the database with the dialect of the uri scheme, or the one
+// set in the config
+func connect(uri string) (*sql.DB, makoto.Dialect) {
+	con, dialect, err := db.Connect(uri)
+	logError(err)
+	if dialectName != "" {
+		dialect, err = makoto.GetDialect(dialectName)
+		logError(err)
+	}
+	return con, dialect
 }
 
 func configureDBUri() {
@@ -244,6 +549,9 @@ func loadDBConfig() error {
 	err = toml.Unmarshal(configSt, &config)
 	logError(err)
 
+	// the config connects with the postgres protocol, which CockroachDB
+	// speaks too
+	dialectName = config.Dialect
 	pg := config.Postgres
 	database = fmt.Sprintf("user=%v password=%v host=%v port=%v dbname=%v sslmode=disable",
 		pg.User, pg.Password, pg.Host, pg.Port, pg.DBName)
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/stanlry/makoto"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// The json and yaml outputs share these schemas, only add fields to them so
+// existing readers keep working.
+
+type listOutput struct {
+	Migrations []listMigration `json:"migrations" yaml:"migrations"`
+}
+
+type listMigration struct {
+	Version       int    `json:"version" yaml:"version"`
+	Filename      string `json:"filename" yaml:"filename"`
+	NoTransaction bool   `json:"no_transaction" yaml:"no_transaction"`
+	Repeatable    bool   `json:"repeatable" yaml:"repeatable"`
+}
+
+type statusOutput struct {
+	Version    int               `json:"version" yaml:"version"`
+	Dirty      bool              `json:"dirty" yaml:"dirty"`
+	Migrations []statusMigration `json:"migrations" yaml:"migrations"`
+}
+
+type statusMigration struct {
+	Version  int    `json:"version" yaml:"version"`
+	Filename string `json:"filename" yaml:"filename"`
+	// applied, pending or missing
+	State         string `json:"state" yaml:"state"`
+	AppliedAt     string `json:"applied_at,omitempty" yaml:"applied_at,omitempty"`
+	ChecksumMatch bool   `json:"checksum_match" yaml:"checksum_match"`
+	Repeatable    bool   `json:"repeatable" yaml:"repeatable"`
+}
+
+type historyOutput struct {
+	Records []historyRecord `json:"records" yaml:"records"`
+}
+
+type historyRecord struct {
+	Version  int    `json:"version" yaml:"version"`
+	Filename string `json:"filename" yaml:"filename"`
+	// up, down or repeat
+	Exectype string `json:"exectype" yaml:"exectype"`
+	// started, succeeded, failed, forced or baseline
+	Status    string `json:"status" yaml:"status"`
+	Error     string `json:"error,omitempty" yaml:"error,omitempty"`
+	CreatedAt string `json:"created_at" yaml:"created_at"`
+}
+
+type planOutput struct {
+	Steps []planStep `json:"steps" yaml:"steps"`
+}
+
+type planStep struct {
+	// up, down or repeat
+	Direction     string `json:"direction" yaml:"direction"`
+	Version       int    `json:"version" yaml:"version"`
+	Filename      string `json:"filename" yaml:"filename"`
+	SQL           string `json:"sql" yaml:"sql"`
+	Transactional bool   `json:"transactional" yaml:"transactional"`
+}
+
+type migrateOutput struct {
+	FromVersion int    `json:"from_version" yaml:"from_version"`
+	ToVersion   int    `json:"to_version" yaml:"to_version"`
+	Applied     []int  `json:"applied" yaml:"applied"`
+	Reverted    []int  `json:"reverted" yaml:"reverted"`
+	Dirty       bool   `json:"dirty" yaml:"dirty"`
+	Error       string `json:"error,omitempty" yaml:"error,omitempty"`
+	// filenames of the repeatable scripts that ran, they have no version
+	Repeated []string `json:"repeated" yaml:"repeated"`
+}
+
+type validateOutput struct {
+	Drifts []validateDrift `json:"drifts" yaml:"drifts"`
+}
+
+type validateDrift struct {
+	Version  int    `json:"version" yaml:"version"`
+	Filename string `json:"filename" yaml:"filename"`
+	// checksum mismatch, missing file or skipped
+	Problem string `json:"problem" yaml:"problem"`
+}
+
+func checkOutput() error {
+	switch output {
+	case outputTable, outputJSON, outputYAML:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, use table, json or yaml", output)
+}
+
+// render writes v as json or yaml, or calls table for the table output
+func render(v interface{}, table func()) error {
+	switch output {
+	case outputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case outputYAML:
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		defer enc.Close()
+		return enc.Encode(v)
+	}
+	table()
+	return nil
+}
+
+func newListOutput(collection *makoto.MigrationCollection) listOutput {
+	out := listOutput{Migrations: []listMigration{}}
+	for item := collection.Head(); item != nil; item = item.Next() {
+		st := item.Statement()
+		out.Migrations = append(out.Migrations, listMigration{st.Version, st.Filename, st.NoTransaction, false})
+	}
+	for _, st := range collection.Repeatables() {
+		out.Migrations = append(out.Migrations, listMigration{st.Version, st.Filename, st.NoTransaction, true})
+	}
+	return out
+}
+
+func newStatusOutput(status *makoto.SchemaStatus) statusOutput {
+	out := statusOutput{
+		Version:    status.Version,
+		Dirty:      status.Dirty,
+		Migrations: []statusMigration{},
+	}
+	for _, ms := range status.Migrations {
+		sm := statusMigration{
+			Version:       ms.Version,
+			Filename:      ms.Filename,
+			State:         statusState(ms),
+			ChecksumMatch: ms.ChecksumMatch,
+			Repeatable:    ms.Repeatable,
+		}
+		if ms.Applied {
+			sm.AppliedAt = ms.AppliedAt.Format(time.RFC3339)
+		}
+		out.Migrations = append(out.Migrations, sm)
+	}
+	return out
+}
+
+// statusState returns applied, pending or missing, repeatable scripts that
+// changed since they last ran are pending
+func statusState(ms makoto.MigrationStatus) string {
+	switch {
+	case ms.Missing:
+		return "missing"
+	case ms.Repeatable && !ms.ChecksumMatch:
+		return "pending"
+	case ms.Applied:
+		return "applied"
+	}
+	return "pending"
+}
+
+func newHistoryOutput(records []makoto.MigrationRecord) historyOutput {
+	out := historyOutput{Records: []historyRecord{}}
+	for _, record := range records {
+		out.Records = append(out.Records, historyRecord{
+			Version:   record.Version,
+			Filename:  record.Filename,
+			Exectype:  record.Exectype,
+			Status:    record.Status,
+			Error:     record.Error,
+			CreatedAt: record.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return out
+}
+
+func newPlanOutput(steps []makoto.Step) planOutput {
+	out := planOutput{Steps: []planStep{}}
+	for _, step := range steps {
+		out.Steps = append(out.Steps, planStep{step.Direction, step.Version, step.Filename, step.SQL, step.Transactional})
+	}
+	return out
+}
+
+func newValidateOutput(drifts []makoto.Drift) validateOutput {
+	out := validateOutput{Drifts: []validateDrift{}}
+	for _, d := range drifts {
+		out.Drifts = append(out.Drifts, validateDrift{d.Version, d.Filename, string(d.Kind)})
+	}
+	return out
+}
+
+// reportMigration runs fn and, for the json and yaml outputs, reports the
+// versions it applied and reverted and the repeatable scripts it ran
+func reportMigration(ctx context.Context, migrator *makoto.Migrator, fn func() error) error {
+	fn = withSchemaDump(ctx, migrator, fn)
+	if output == outputTable {
+		return fn()
+	}
+
+	before, err := migrator.StatusContext(ctx)
+	if err != nil {
+		return err
+	}
+	runErr := fn()
+	after, err := migrator.StatusContext(context.Background())
+	if err != nil {
+		return err
+	}
+
+	out := migrateOutput{
+		FromVersion: before.Version,
+		ToVersion:   after.Version,
+		Applied:     []int{},
+		Reverted:    []int{},
+		Dirty:       after.Dirty,
+		Repeated:    []string{},
+	}
+	if runErr != nil {
+		out.Error = runErr.Error()
+	}
+
+	applied := map[int]bool{}
+	repeated := map[string]makoto.MigrationStatus{}
+	for _, ms := range before.Migrations {
+		if ms.Repeatable {
+			repeated[ms.Filename] = ms
+			continue
+		}
+		applied[ms.Version] = ms.Applied
+	}
+	for _, ms := range after.Migrations {
+		if ms.Repeatable {
+			if ranAgain(repeated[ms.Filename], ms) {
+				out.Repeated = append(out.Repeated, ms.Filename)
+			}
+			continue
+		}
+
+		switch {
+		case ms.Applied && !applied[ms.Version]:
+			out.Applied = append(out.Applied, ms.Version)
+		case !ms.Applied && applied[ms.Version]:
+			out.Reverted = append(out.Reverted, ms.Version)
+		}
+	}
+
+	if err := render(out, nil); err != nil {
+		return err
+	}
+	return runErr
+}
+
+// ranAgain reports whether a repeatable script ran between the before and
+// after states, it was pending before or its latest run changed.
+func ranAgain(before, after makoto.MigrationStatus) bool {
+	if !after.Applied || !after.ChecksumMatch {
+		return false
+	}
+	return !before.Applied || !before.ChecksumMatch || !before.AppliedAt.Equal(after.AppliedAt)
+}
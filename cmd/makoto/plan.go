@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/stanlry/makoto"
+	cli "github.com/urfave/cli/v2"
+)
+
+var dryRunFlag = &cli.BoolFlag{
+	Name:  "dry-run",
+	Usage: "Print the scripts that would run without running them",
+}
+
+var errVersionAndSteps = errors.New("--version and --steps cannot be used together")
+
+// runSteps migrates the number of scripts given by --steps in direction
+func runSteps(ctx *cli.Context, migrator *makoto.Migrator, direction string) error {
+	n := ctx.Int("steps")
+	if n < 0 {
+		return errors.New("--steps must not be negative")
+	}
+	if direction == makoto.ExecDOWN {
+		n = -n
+	}
+	if !ctx.Bool("dry-run") {
+		return reportMigration(ctx.Context, migrator, func() error {
+			return migrator.StepsContext(ctx.Context, n)
+		})
+	}
+
+	steps, err := migrator.PlanStepsContext(ctx.Context, n)
+	if err != nil {
+		return err
+	}
+	return printSteps(steps)
+}
+
+// printPlan prints the scripts and sql that migrating to version would run
+func printPlan(ctx context.Context, migrator *makoto.Migrator, version int, direction string) error {
+	steps, err := migrator.PlanContext(ctx, version)
+	if err != nil {
+		return err
+	}
+
+	// reverting never runs repeatable scripts, a database at the version
+	// only has the ones of the head pending
+	planned := []makoto.Step{}
+	for _, step := range steps {
+		switch {
+		case direction == makoto.ExecUP && step.Direction == makoto.ExecDOWN:
+			return makoto.ErrDatabaseAhead
+		case direction == makoto.ExecDOWN && step.Direction == makoto.ExecUP:
+			return makoto.ErrDatabaseBehind
+		case direction == makoto.ExecDOWN && step.Direction == makoto.ExecREPEAT:
+			continue
+		}
+		planned = append(planned, step)
+	}
+	return printSteps(planned)
+}
+
+func printSteps(steps []makoto.Step) error {
+	return render(newPlanOutput(steps), func() {
+		if len(steps) == 0 {
+			fmt.Println("Nothing to migrate")
+			return
+		}
+
+		for i, step := range steps {
+			tx := "transaction"
+			if !step.Transactional {
+				tx = "no transaction"
+			}
+			fmt.Printf("-- [%d/%d] %s %v %s (%s)\n", i+1, len(steps), step.Direction, step.Version, step.Filename, tx)
+			fmt.Println(step.SQL)
+		}
+	})
+}
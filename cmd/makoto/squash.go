@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/stanlry/makoto"
+)
+
+const archiveDir = "archive"
+
+var errNothingToSquash = errors.New("no migration script to squash")
+
+// squash replaces the scripts up to version upto with a single script of the
+// same version and moves them to migration/archive. The up statement is the
+// concatenation of the scripts, or the schema dump of a scratch database
+// migrated to upto.
+func squash(ctx context.Context, upto int, scratch string) error {
+	dir := getSQLScriptDir()
+	collection := processMigrationCollection(dir)
+	if collection.FindStatement(upto) == nil {
+		return fmt.Errorf("%w: %v", makoto.ErrTargetVersionNotFound, upto)
+	}
+
+	statements := []*makoto.MigrateStatement{}
+	for item := collection.Head(); item != nil && item.Statement().Version <= upto; item = item.Next() {
+		statements = append(statements, item.Statement())
+	}
+	if len(statements) == 0 {
+		return errNothingToSquash
+	}
+
+	up := squashStatements(statements, makoto.ExecUP)
+	if scratch != "" {
+		var err error
+		up, err = dumpScratchSchema(ctx, scratch, collection, upto)
+		if err != nil {
+			return err
+		}
+	}
+
+	// down statements revert in the opposite order
+	reversed := make([]*makoto.MigrateStatement, len(statements))
+	for i, st := range statements {
+		reversed[len(statements)-1-i] = st
+	}
+	down := squashStatements(reversed, makoto.ExecDOWN)
+
+	buffer := bytes.NewBuffer(nil)
+	fmt.Fprintln(buffer, "-- makoto:squash")
+	for _, st := range statements {
+		fmt.Fprintf(buffer, "-- squashed %s\n", st.Filename)
+	}
+	fmt.Fprintf(buffer, "\n-- Up\n%s\n-- Down\n%s", up, down)
+
+	archivePath := filepath.Join(filepath.Dir(dir), archiveDir)
+	for _, st := range statements {
+		// keep the subdirectories of the scripts in the archive
+		dest := filepath.Join(archivePath, filepath.FromSlash(st.Filename))
+		if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(dir, filepath.FromSlash(st.Filename)), dest); err != nil {
+			return err
+		}
+		log.Printf("Archived %v\n", st.Filename)
+	}
+
+	filename := fmt.Sprintf("%v_squashed.sql", upto)
+	if err := ioutil.WriteFile(filepath.Join(dir, filename), buffer.Bytes(), 0644); err != nil {
+		return err
+	}
+	log.Println("Create squashed migration script: ", filename)
+	return nil
+}
+
+// squashStatements concatenates the scripts of the execution type without
+// their header directives.
+func squashStatements(statements []*makoto.MigrateStatement, exectype string) string {
+	var buf strings.Builder
+	for _, st := range statements {
+		if st.NoTransaction && exectype == makoto.ExecUP {
+			log.Printf("%v runs without a transaction, check the squashed script\n", st.Filename)
+		}
+
+		fmt.Fprintf(&buf, "-- %s\n", st.Filename)
+		scanner := bufio.NewScanner(strings.NewReader(st.Script(exectype)))
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(strings.TrimSpace(line), "-- makoto:") {
+				continue
+			}
+			buf.WriteString(line + "\n")
+		}
+	}
+	return buf.String()
+}
+
+// dumpScratchSchema migrates the empty scratch database to upto and returns
+// its schema as dumped by pg_dump, without the migration tables.
+func dumpScratchSchema(ctx context.Context, uri string, collection *makoto.MigrationCollection, upto int) (string, error) {
+	con, dialect := connect(uri)
+	if dialect != makoto.Postgres {
+		con.Close()
+		return "", fmt.Errorf("pg_dump needs a postgres scratch database, not %s", dialect.Name())
+	}
+	migrator := makoto.GetMigrator(con, collection)
+	defer migrator.Close()
+	if err := migrator.EnsureSchemaContext(ctx, upto); err != nil {
+		return "", err
+	}
+
+	cmd := exec.CommandContext(ctx, "pg_dump",
+		"--schema-only", "--no-owner", "--no-privileges",
+		"--exclude-table=schema_version", "--exclude-table=schema_seed",
+		"--dbname="+uri)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("pg_dump: %w", err)
+	}
+
+	// the dump empties the search_path of the session and may contain psql
+	// meta commands, neither belongs in a migration
+	var buf strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "\\") || strings.HasPrefix(line, "SELECT pg_catalog.set_config('search_path'") {
+			continue
+		}
+		buf.WriteString(line + "\n")
+	}
+	return buf.String(), scanner.Err()
+}
@@ -1,9 +1,9 @@
 package makoto
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"log"
 )
 
 var (
@@ -19,63 +19,62 @@ SELECT
 	checksum,
 	exectype,
 	statement,
+	status,
+	COALESCE(error, ''),
 	created_at
 FROM schema_version
 `
+	// placeholders are rebound to the dialect
 	_sqlSave = `
-INSERT INTO schema_version (version, filename, checksum, exectype, statement) 
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO schema_version (version, filename, checksum, exectype, statement, status) 
+VALUES (?, ?, ?, ?, ?, ?)`
+	_sqlUpdateStatus = `
+UPDATE schema_version SET status = ?, error = NULLIF(?, '') WHERE id = ?
 `
 )
 
-func createSchemaVersionTable(db *sql.DB) error {
-	sql := `
-	CREATE TABLE IF NOT EXISTS schema_version (
-		id serial PRIMARY KEY,
-		version bigint,
-		filename text,
-		checksum text,
-		exectype text,
-		statement text,
-		created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP
-	)
-	`
-	tx, err := db.Begin()
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-			log.Println("Rollback migration, Error: ", r)
-		}
-	}()
-
-	stmt, err := tx.Prepare(sql)
+func createSchemaVersionTable(ctx context.Context, d Dialect, db txBeginner) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
 
-	_, err = stmt.Exec()
-	if err != nil {
+	if err := execAll(ctx, tx, d.HistoryTable()); err != nil {
+		tx.Rollback()
 		return err
 	}
 
 	return tx.Commit()
 }
 
-func addRecord(tx *sql.Tx, version int, filename, checksum, exectype, statement string) error {
-	_, err := tx.Exec(_sqlSave, version, filename, checksum, exectype, statement)
+func addRecord(ctx context.Context, d Dialect, db Executor, version int, filename, checksum, exectype, statement, status string) (int, error) {
+	return d.InsertRecord(ctx, db, rebind(d, _sqlSave), version, filename, checksum, exectype, statement, status)
+}
+
+func updateRecordStatus(ctx context.Context, d Dialect, db Executor, id int, status, errText string) error {
+	_, err := db.ExecContext(ctx, rebind(d, _sqlUpdateStatus), status, errText, id)
 	return err
 }
 
-func getLastRecord(db *sql.DB) (*MigrationRecord, error) {
+// lastRecord is like getLastRecord but returns ErrRecordNotFound without a
+// schema_version table.
+func (m *Migrator) lastRecord(ctx context.Context, db Executor) (*MigrationRecord, error) {
+	exists, err := m.dialect.HasTable(ctx, db, "schema_version")
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrRecordNotFound
+	}
+	return getLastRecord(ctx, db)
+}
+
+func getLastRecord(ctx context.Context, db Executor) (*MigrationRecord, error) {
 	query := _sqlFind + `
 ORDER by id desc
 LIMIT 1
 	`
-	row, err := db.Query(query)
+	row, err := db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -93,7 +92,15 @@ LIMIT 1
 }
 
 func GetAllRecords(db *sql.DB) ([]MigrationRecord, error) {
-	rows, err := db.Query(_sqlFind)
+	return GetAllRecordsContext(context.Background(), db)
+}
+
+func GetAllRecordsContext(ctx context.Context, db *sql.DB) ([]MigrationRecord, error) {
+	return getAllRecords(ctx, db)
+}
+
+func getAllRecords(ctx context.Context, db Executor) ([]MigrationRecord, error) {
+	rows, err := db.QueryContext(ctx, _sqlFind+"ORDER BY id")
 	if err != nil {
 		return nil, err
 	}
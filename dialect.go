@@ -0,0 +1,119 @@
+package makoto
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Dialect is the SQL of the database a migrator runs on. Postgres is the
+// default, SetDialect changes it.
+type Dialect interface {
+	// Name returns the name GetDialect finds the dialect by.
+	Name() string
+	// Placeholder returns the bind parameter of the nth argument of a query,
+	// counting from 1.
+	Placeholder(n int) string
+	// HistoryTable returns the statements creating the schema_version table,
+	// or upgrading the one of an older makoto.
+	HistoryTable() []string
+	// SeedTable returns the statements creating the schema_seed table.
+	SeedTable() []string
+	// HasTable reports whether the table exists, reads of the history treat a
+	// missing schema_version table as empty instead of creating it.
+	HasTable(ctx context.Context, db Executor, name string) (bool, error)
+	// InsertRecord runs the insert query of a record and returns its id.
+	InsertRecord(ctx context.Context, db Executor, query string, args ...interface{}) (int, error)
+	// TryLock takes the migration lock on conn without waiting and reports
+	// whether it got it.
+	TryLock(ctx context.Context, conn *sql.Conn) (bool, error)
+	// Unlock releases the migration lock taken on conn.
+	Unlock(ctx context.Context, conn *sql.Conn) error
+	// TransactionalDDL reports whether schema changes roll back with the
+	// transaction. Without it every script runs outside of a transaction and
+	// is recorded as started before it runs, like a no-transaction script.
+	TransactionalDDL() bool
+}
+
+// SchemaDumper is implemented by the dialects DumpSchema supports.
+type SchemaDumper interface {
+	DumpSchema(ctx context.Context, db *sql.DB, w io.Writer) error
+}
+
+// TxPreparer is implemented by dialects that set up the connection of a
+// migration transaction before it begins and check the transaction before it
+// commits.
+type TxPreparer interface {
+	// PrepareTx runs on the connection before the transaction begins and
+	// returns the function restoring the connection after it ended.
+	PrepareTx(ctx context.Context, conn *sql.Conn) (restore func() error, err error)
+	// CheckTx runs before the transaction commits, an error rolls it back.
+	CheckTx(ctx context.Context, tx *sql.Tx) error
+}
+
+// SingleScriptTx is implemented by dialects that run every script in a
+// transaction of its own, as in TxModeEach, when SingleScriptTx returns true.
+type SingleScriptTx interface {
+	SingleScriptTx() bool
+}
+
+// Executor is satisfied by *sql.DB, *sql.Tx and *sql.Conn.
+type Executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+var dialects = map[string]Dialect{}
+
+// RegisterDialect makes a dialect available to GetDialect by its name.
+func RegisterDialect(d Dialect) {
+	dialects[d.Name()] = d
+}
+
+// GetDialect returns the dialect registered under name.
+func GetDialect(name string) (Dialect, error) {
+	d, ok := dialects[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDialect, name)
+	}
+	return d, nil
+}
+
+// SetDialect sets the SQL dialect of the database, the default is Postgres.
+func (m *Migrator) SetDialect(d Dialect) {
+	m.dialect = d
+}
+
+// Dialect returns the SQL dialect of the database.
+func (m *Migrator) Dialect() Dialect {
+	return m.dialect
+}
+
+// rebind replaces every ? of query with the placeholder of the dialect.
+func rebind(d Dialect, query string) string {
+	var buf strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			buf.WriteString(d.Placeholder(n))
+			continue
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// execAll runs the statements one by one, not every driver runs several
+// statements in one call.
+func execAll(ctx context.Context, db Executor, statements []string) error {
+	for _, statement := range statements {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package makoto
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"time"
+)
+
+const _sqlCockroachDump = `
+SELECT schema_name || '.' || descriptor_name, descriptor_type, create_statement
+FROM crdb_internal.create_statements
+WHERE database_name = current_database()
+AND descriptor_name NOT IN ('schema_version', 'schema_seed', 'schema_lock', 'schema_version_id_seq', 'schema_seed_id_seq')`
+
+// Cockroach is the dialect of CockroachDB. It speaks the Postgres protocol
+// but has no advisory lock, so migrations take the lock by inserting a row
+// into the schema_lock table. Schema changes are not fully transactional
+// there, every script runs in a transaction of its own whatever the
+// transaction mode.
+var Cockroach Dialect = cockroachDialect{}
+
+func init() {
+	RegisterDialect(Cockroach)
+}
+
+type cockroachDialect struct {
+	postgresDialect
+}
+
+func (cockroachDialect) Name() string {
+	return "cockroach"
+}
+
+// HistoryTable numbers records with a sequence, serial ids of CockroachDB
+// are unique but not in insert order. Tables created by an older makoto with
+// the Postgres DDL get the status and error columns added.
+func (cockroachDialect) HistoryTable() []string {
+	return []string{
+		`CREATE SEQUENCE IF NOT EXISTS schema_version_id_seq`,
+		`
+	CREATE TABLE IF NOT EXISTS schema_version (
+		id INT8 PRIMARY KEY DEFAULT nextval('schema_version_id_seq'),
+		version INT8,
+		filename STRING,
+		checksum STRING,
+		exectype STRING,
+		statement STRING,
+		status STRING NOT NULL DEFAULT 'succeeded',
+		error STRING,
+		created_at TIMESTAMPTZ DEFAULT now()
+	)`,
+		`ALTER TABLE schema_version ADD COLUMN IF NOT EXISTS status STRING NOT NULL DEFAULT 'succeeded'`,
+		`ALTER TABLE schema_version ADD COLUMN IF NOT EXISTS error STRING`,
+	}
+}
+
+func (cockroachDialect) SeedTable() []string {
+	return []string{
+		`CREATE SEQUENCE IF NOT EXISTS schema_seed_id_seq`,
+		`
+	CREATE TABLE IF NOT EXISTS schema_seed (
+		id INT8 PRIMARY KEY DEFAULT nextval('schema_seed_id_seq'),
+		env STRING,
+		filename STRING,
+		checksum STRING,
+		created_at TIMESTAMPTZ DEFAULT now()
+	)`,
+	}
+}
+
+func (d cockroachDialect) TryLock(ctx context.Context, conn *sql.Conn) (bool, error) {
+	return tryLockTable(ctx, d, conn)
+}
+
+func (cockroachDialect) Unlock(ctx context.Context, conn *sql.Conn) error {
+	return unlockTable(ctx, conn)
+}
+
+func (d cockroachDialect) BreakLock(ctx context.Context, conn *sql.Conn, lease time.Duration) (bool, error) {
+	return breakLockTable(ctx, d, conn, lease)
+}
+
+// SingleScriptTx keeps the scripts of a migration out of each other's
+// transaction, CockroachDB rejects many batches of mixed DDL and DML.
+func (cockroachDialect) SingleScriptTx() bool {
+	return true
+}
+
+// DumpSchema writes the create statement of every table, view and sequence as
+// shown by CockroachDB.
+func (cockroachDialect) DumpSchema(ctx context.Context, db *sql.DB, w io.Writer) error {
+	return writeDump(ctx, db, w, []func(context.Context, Executor) ([]schemaObject, error){
+		func(ctx context.Context, db Executor) ([]schemaObject, error) {
+			return queryObjects(ctx, db, _sqlCockroachDump, func(name, descriptorType, ddl string) string {
+				return ddl + ";"
+			})
+		},
+	})
+}
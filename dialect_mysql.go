@@ -0,0 +1,190 @@
+package makoto
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const (
+	// lock names are global to the server, the name of the database keeps
+	// migrations of different databases apart
+	_sqlMySQLTryLock = `SELECT GET_LOCK(CONCAT(DATABASE(), '.schema_version'), 0)`
+	_sqlMySQLUnlock  = `SELECT RELEASE_LOCK(CONCAT(DATABASE(), '.schema_version'))`
+
+	_sqlMySQLHasTable = `
+SELECT count(*) FROM information_schema.tables
+WHERE table_schema = DATABASE() AND table_name = ?`
+
+	_sqlMySQLDumpTables = `
+SELECT table_name FROM information_schema.tables
+WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE'
+AND table_name NOT IN ('schema_version', 'schema_seed')`
+	_sqlMySQLDumpRoutines = `
+SELECT routine_type, routine_name FROM information_schema.routines
+WHERE routine_schema = DATABASE()`
+)
+
+// the next id of a table changes with every insert and does not belong in
+// the dump
+var autoIncrementRegexp = regexp.MustCompile(` AUTO_INCREMENT=[0-9]+`)
+
+// MySQL is the dialect of MySQL and MariaDB. DDL commits implicitly there, so
+// every script runs and is recorded on its own, and migrations take a named
+// lock with GET_LOCK.
+var MySQL Dialect = mysqlDialect{}
+
+func init() {
+	RegisterDialect(MySQL)
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string {
+	return "mysql"
+}
+
+func (mysqlDialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (mysqlDialect) HistoryTable() []string {
+	return []string{`
+	CREATE TABLE IF NOT EXISTS schema_version (
+		id bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		version bigint,
+		filename varchar(255),
+		checksum varchar(255),
+		exectype varchar(16),
+		statement longtext,
+		status varchar(16) NOT NULL DEFAULT 'succeeded',
+		error text,
+		created_at datetime DEFAULT CURRENT_TIMESTAMP
+	)`}
+}
+
+func (mysqlDialect) SeedTable() []string {
+	return []string{`
+	CREATE TABLE IF NOT EXISTS schema_seed (
+		id bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		env varchar(255),
+		filename varchar(255),
+		checksum varchar(255),
+		created_at datetime DEFAULT CURRENT_TIMESTAMP
+	)`}
+}
+
+func (mysqlDialect) HasTable(ctx context.Context, db Executor, name string) (bool, error) {
+	var count int
+	err := db.QueryRowContext(ctx, _sqlMySQLHasTable, name).Scan(&count)
+	return count > 0, err
+}
+
+func (mysqlDialect) InsertRecord(ctx context.Context, db Executor, query string, args ...interface{}) (int, error) {
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// TryLock takes a named lock, which belongs to the session like the advisory
+// lock of Postgres.
+func (mysqlDialect) TryLock(ctx context.Context, conn *sql.Conn) (bool, error) {
+	var locked sql.NullInt64
+	err := conn.QueryRowContext(ctx, _sqlMySQLTryLock).Scan(&locked)
+	return locked.Int64 == 1, err
+}
+
+func (mysqlDialect) Unlock(ctx context.Context, conn *sql.Conn) error {
+	var released sql.NullInt64
+	return conn.QueryRowContext(ctx, _sqlMySQLUnlock).Scan(&released)
+}
+
+func (mysqlDialect) TransactionalDDL() bool {
+	return false
+}
+
+// DumpSchema writes SHOW CREATE of every table and routine of the current
+// database.
+func (mysqlDialect) DumpSchema(ctx context.Context, db *sql.DB, w io.Writer) error {
+	return writeDump(ctx, db, w, []func(context.Context, Executor) ([]schemaObject, error){
+		dumpMySQLTables,
+		dumpMySQLRoutines,
+	})
+}
+
+func dumpMySQLTables(ctx context.Context, db Executor) ([]schemaObject, error) {
+	names, err := queryNames(ctx, db, _sqlMySQLDumpTables)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []schemaObject{}
+	for _, name := range names {
+		var table, ddl string
+		query := fmt.Sprintf("SHOW CREATE TABLE %s", quoteMySQL(name[0]))
+		if err := db.QueryRowContext(ctx, query).Scan(&table, &ddl); err != nil {
+			return nil, err
+		}
+		ddl = autoIncrementRegexp.ReplaceAllString(ddl, "")
+		objects = append(objects, schemaObject{name: table, ddl: ddl + ";"})
+	}
+	return objects, nil
+}
+
+func dumpMySQLRoutines(ctx context.Context, db Executor) ([]schemaObject, error) {
+	names, err := queryNames(ctx, db, _sqlMySQLDumpRoutines)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []schemaObject{}
+	for _, name := range names {
+		// the create statement is the third of the six columns
+		var routine, sqlMode, ddl, charset, collation, dbCollation sql.NullString
+		query := fmt.Sprintf("SHOW CREATE %s %s", name[0], quoteMySQL(name[1]))
+		err := db.QueryRowContext(ctx, query).Scan(&routine, &sqlMode, &ddl, &charset, &collation, &dbCollation)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, schemaObject{table: name[0], name: name[1], ddl: ddl.String + ";"})
+	}
+	return objects, nil
+}
+
+// queryNames returns the rows of query, every column scanned as a string.
+func queryNames(ctx context.Context, db Executor, query string) ([][]string, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	names := [][]string{}
+	for rows.Next() {
+		row := make([]string, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		names = append(names, row)
+	}
+	return names, rows.Err()
+}
+
+func quoteMySQL(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
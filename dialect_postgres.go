@@ -0,0 +1,102 @@
+package makoto
+
+import (
+	"context"
+	"database/sql"
+	"hash/crc32"
+	"io"
+	"strconv"
+)
+
+const (
+	_sqlTryLock = `SELECT pg_try_advisory_lock($1)`
+	_sqlUnlock  = `SELECT pg_advisory_unlock($1)`
+
+	// the table is looked up on the search_path like the unqualified names of
+	// the migration queries
+	_sqlHasTable = `SELECT to_regclass($1) IS NOT NULL`
+)
+
+// the advisory lock is keyed on the schema version table so every process
+// migrating the same database contends for the same lock
+var lockKey = int64(crc32.ChecksumIEEE([]byte("schema_version")))
+
+// Postgres is the dialect of PostgreSQL, it takes an advisory lock for
+// migrations.
+var Postgres Dialect = postgresDialect{}
+
+func init() {
+	RegisterDialect(Postgres)
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string {
+	return "postgres"
+}
+
+func (postgresDialect) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func (postgresDialect) HistoryTable() []string {
+	return []string{`
+	CREATE TABLE IF NOT EXISTS schema_version (
+		id serial PRIMARY KEY,
+		version bigint,
+		filename text,
+		checksum text,
+		exectype text,
+		statement text,
+		status text NOT NULL DEFAULT 'succeeded',
+		error text,
+		created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP
+	)`,
+		`ALTER TABLE schema_version ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'succeeded'`,
+		`ALTER TABLE schema_version ADD COLUMN IF NOT EXISTS error text`,
+	}
+}
+
+func (postgresDialect) SeedTable() []string {
+	return []string{`
+	CREATE TABLE IF NOT EXISTS schema_seed (
+		id serial PRIMARY KEY,
+		env text,
+		filename text,
+		checksum text,
+		created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP
+	)`}
+}
+
+func (postgresDialect) HasTable(ctx context.Context, db Executor, name string) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, _sqlHasTable, name).Scan(&exists)
+	return exists, err
+}
+
+func (postgresDialect) InsertRecord(ctx context.Context, db Executor, query string, args ...interface{}) (int, error) {
+	var id int
+	err := db.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+	return id, err
+}
+
+// TryLock takes a session advisory lock, so the lock and unlock have to run on
+// the same connection.
+func (postgresDialect) TryLock(ctx context.Context, conn *sql.Conn) (bool, error) {
+	var locked bool
+	err := conn.QueryRowContext(ctx, _sqlTryLock, lockKey).Scan(&locked)
+	return locked, err
+}
+
+func (postgresDialect) Unlock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, _sqlUnlock, lockKey)
+	return err
+}
+
+func (postgresDialect) TransactionalDDL() bool {
+	return true
+}
+
+func (postgresDialect) DumpSchema(ctx context.Context, db *sql.DB, w io.Writer) error {
+	return dumpPostgres(ctx, db, w)
+}
@@ -0,0 +1,179 @@
+package makoto
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	_sqlSQLiteDump = `
+SELECT tbl_name, name, sql FROM sqlite_master
+WHERE type = ? AND sql IS NOT NULL AND name NOT LIKE 'sqlite_%'
+AND tbl_name NOT IN ('schema_version', 'schema_seed', 'schema_lock')`
+
+	_sqlSQLiteHasTable = `SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?`
+)
+
+// SQLite is the dialect of SQLite. SQLite has no session lock, migrations take
+// the lock by inserting a row into the schema_lock table.
+//
+// ALTER TABLE of SQLite cannot change columns or constraints, a script
+// rebuilds the table instead. To allow that, foreign keys are disabled while a
+// migration transaction runs and checked with PRAGMA foreign_key_check before
+// it commits.
+var SQLite Dialect = sqliteDialect{}
+
+func init() {
+	RegisterDialect(SQLite)
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (sqliteDialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (sqliteDialect) HistoryTable() []string {
+	return []string{`
+	CREATE TABLE IF NOT EXISTS schema_version (
+		id integer PRIMARY KEY AUTOINCREMENT,
+		version integer,
+		filename text,
+		checksum text,
+		exectype text,
+		statement text,
+		status text NOT NULL DEFAULT 'succeeded',
+		error text,
+		created_at timestamp DEFAULT CURRENT_TIMESTAMP
+	)`}
+}
+
+func (sqliteDialect) SeedTable() []string {
+	return []string{`
+	CREATE TABLE IF NOT EXISTS schema_seed (
+		id integer PRIMARY KEY AUTOINCREMENT,
+		env text,
+		filename text,
+		checksum text,
+		created_at timestamp DEFAULT CURRENT_TIMESTAMP
+	)`}
+}
+
+func (sqliteDialect) HasTable(ctx context.Context, db Executor, name string) (bool, error) {
+	var count int
+	err := db.QueryRowContext(ctx, _sqlSQLiteHasTable, name).Scan(&count)
+	return count > 0, err
+}
+
+func (sqliteDialect) InsertRecord(ctx context.Context, db Executor, query string, args ...interface{}) (int, error) {
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+func (d sqliteDialect) TryLock(ctx context.Context, conn *sql.Conn) (bool, error) {
+	return tryLockTable(ctx, d, conn)
+}
+
+func (sqliteDialect) Unlock(ctx context.Context, conn *sql.Conn) error {
+	return unlockTable(ctx, conn)
+}
+
+func (d sqliteDialect) BreakLock(ctx context.Context, conn *sql.Conn, lease time.Duration) (bool, error) {
+	return breakLockTable(ctx, d, conn, lease)
+}
+
+func (sqliteDialect) TransactionalDDL() bool {
+	return true
+}
+
+// PrepareTx disables foreign keys, which cannot be changed inside a
+// transaction, and enables them again afterwards if they were on.
+func (sqliteDialect) PrepareTx(ctx context.Context, conn *sql.Conn) (func() error, error) {
+	var enabled bool
+	if err := conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&enabled); err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return func() error { return nil }, nil
+	}
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return nil, err
+	}
+	return func() error {
+		_, err := conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON")
+		return err
+	}, nil
+}
+
+// CheckTx fails when the migration left rows that violate a foreign key.
+func (sqliteDialect) CheckTx(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tables := []string{}
+	seen := map[string]bool{}
+	for rows.Next() {
+		var table, parent string
+		var rowid sql.NullInt64
+		var fkid int
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			return err
+		}
+		violation := fmt.Sprintf("%s references %s", table, parent)
+		if !seen[violation] {
+			seen[violation] = true
+			tables = append(tables, violation)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(tables) > 0 {
+		return fmt.Errorf("foreign key violation: %s", strings.Join(tables, ", "))
+	}
+	return nil
+}
+
+// DumpSchema writes the sql of every table, index, view and trigger as
+// stored in sqlite_master.
+func (sqliteDialect) DumpSchema(ctx context.Context, db *sql.DB, w io.Writer) error {
+	sections := []func(context.Context, Executor) ([]schemaObject, error){}
+	for _, objectType := range []string{"table", "index", "view", "trigger"} {
+		objectType := objectType
+		sections = append(sections, func(ctx context.Context, db Executor) ([]schemaObject, error) {
+			rows, err := db.QueryContext(ctx, _sqlSQLiteDump, objectType)
+			if err != nil {
+				return nil, err
+			}
+			defer rows.Close()
+
+			objects := []schemaObject{}
+			for rows.Next() {
+				var object schemaObject
+				if err := rows.Scan(&object.table, &object.name, &object.ddl); err != nil {
+					return nil, err
+				}
+				object.ddl += ";"
+				objects = append(objects, object)
+			}
+			return objects, rows.Err()
+		})
+	}
+	return writeDump(ctx, db, w, sections)
+}
@@ -0,0 +1,238 @@
+package makoto
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// every query leaves out the system schemas, objects of extensions and the
+// tables of makoto itself
+const _dumpSchemaFilter = `n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg_toast%' AND n.nspname NOT LIKE 'pg_temp%'`
+
+const _sqlDumpEnums = `SELECT format('%I.%I', n.nspname, t.typname),
+	string_agg(quote_literal(e.enumlabel), ', ' ORDER BY e.enumsortorder)
+FROM pg_type t
+JOIN pg_namespace n ON n.oid = t.typnamespace
+JOIN pg_enum e ON e.enumtypid = t.oid
+WHERE ` + _dumpSchemaFilter + `
+AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = t.oid AND d.deptype = 'e')
+GROUP BY n.nspname, t.typname`
+
+const _sqlDumpColumns = `SELECT format('%I.%I', n.nspname, c.relname), format('%I', a.attname),
+	format_type(a.atttypid, a.atttypmod), a.attnotnull,
+	COALESCE(pg_get_expr(ad.adbin, ad.adrelid), '')
+FROM pg_class c
+JOIN pg_namespace n ON n.oid = c.relnamespace
+JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+LEFT JOIN pg_attrdef ad ON ad.adrelid = c.oid AND ad.adnum = a.attnum
+WHERE ` + _dumpSchemaFilter + `
+AND c.relkind IN ('r', 'p') AND c.relname NOT IN ('schema_version', 'schema_seed')
+AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = c.oid AND d.deptype = 'e')
+ORDER BY c.oid, a.attnum`
+
+// foreign keys are dumped after the other constraints, which create the
+// unique indexes they refer to
+const _sqlDumpConstraints = `SELECT format('%I.%I', n.nspname, c.relname), format('%I', con.conname),
+	pg_get_constraintdef(con.oid)
+FROM pg_constraint con
+JOIN pg_class c ON c.oid = con.conrelid
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE ` + _dumpSchemaFilter + `
+AND c.relname NOT IN ('schema_version', 'schema_seed')
+AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = c.oid AND d.deptype = 'e')
+AND con.contype IN `
+
+// indexes of primary key, unique and exclusion constraints are created by the
+// constraints
+const _sqlDumpIndexes = `SELECT format('%I.%I', n.nspname, c.relname), format('%I', ic.relname),
+	pg_get_indexdef(i.indexrelid)
+FROM pg_index i
+JOIN pg_class ic ON ic.oid = i.indexrelid
+JOIN pg_class c ON c.oid = i.indrelid
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE ` + _dumpSchemaFilter + `
+AND c.relkind IN ('r', 'p') AND c.relname NOT IN ('schema_version', 'schema_seed')
+AND NOT EXISTS (SELECT 1 FROM pg_constraint con WHERE con.conindid = i.indexrelid AND con.conrelid = i.indrelid AND con.contype IN ('p', 'u', 'x'))
+AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = c.oid AND d.deptype = 'e')`
+
+const _sqlDumpFunctions = `SELECT format('%I.%I', n.nspname, p.proname), pg_get_function_identity_arguments(p.oid),
+	pg_get_functiondef(p.oid)
+FROM pg_proc p
+JOIN pg_namespace n ON n.oid = p.pronamespace
+WHERE ` + _dumpSchemaFilter + `
+AND p.prokind IN ('f', 'p')
+AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = p.oid AND d.deptype = 'e')`
+
+// schemaObject is a statement of the dump with the names it is sorted by.
+type schemaObject struct {
+	table string
+	name  string
+	ddl   string
+}
+
+// DumpSchema writes the DDL of the database to w, sorted by name so the dump
+// only changes when the schema does. Postgres dumps the enums, tables,
+// constraints, indexes and functions read from the catalog.
+func (m *Migrator) DumpSchema(w io.Writer) error {
+	return m.DumpSchemaContext(context.Background(), w)
+}
+
+// DumpSchemaContext is like DumpSchema but runs every database call with ctx.
+func (m *Migrator) DumpSchemaContext(ctx context.Context, w io.Writer) error {
+	dumper, ok := m.dialect.(SchemaDumper)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrDumpNotSupported, m.dialect.Name())
+	}
+	return dumper.DumpSchema(ctx, m.db, w)
+}
+
+func dumpPostgres(ctx context.Context, db Executor, w io.Writer) error {
+	return writeDump(ctx, db, w, []func(context.Context, Executor) ([]schemaObject, error){
+		dumpEnums,
+		dumpTables,
+		dumpConstraints,
+		dumpForeignKeys,
+		dumpIndexes,
+		dumpFunctions,
+	})
+}
+
+// writeDump writes the objects of every section sorted by table and name.
+func writeDump(ctx context.Context, db Executor, w io.Writer, sections []func(context.Context, Executor) ([]schemaObject, error)) error {
+	if _, err := fmt.Fprintln(w, "-- Schema dumped by makoto, do not edit by hand"); err != nil {
+		return err
+	}
+	for _, section := range sections {
+		objects, err := section(ctx, db)
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(objects, func(i, j int) bool {
+			if objects[i].table != objects[j].table {
+				return objects[i].table < objects[j].table
+			}
+			return objects[i].name < objects[j].name
+		})
+		for i, object := range objects {
+			// a blank line before every section and between multi-line statements
+			if i == 0 || strings.Contains(object.ddl, "\n") {
+				if _, err := fmt.Fprintln(w); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintln(w, object.ddl); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// queryObjects scans rows of three columns, the table, the name and the
+// definition the ddl is built from.
+func queryObjects(ctx context.Context, db Executor, query string, ddl func(table, name, def string) string) ([]schemaObject, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := []schemaObject{}
+	for rows.Next() {
+		var table, name, def string
+		if err := rows.Scan(&table, &name, &def); err != nil {
+			return nil, err
+		}
+		objects = append(objects, schemaObject{table, name, ddl(table, name, def)})
+	}
+	return objects, rows.Err()
+}
+
+func dumpEnums(ctx context.Context, db Executor) ([]schemaObject, error) {
+	rows, err := db.QueryContext(ctx, _sqlDumpEnums)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := []schemaObject{}
+	for rows.Next() {
+		var name, labels string
+		if err := rows.Scan(&name, &labels); err != nil {
+			return nil, err
+		}
+		ddl := fmt.Sprintf("CREATE TYPE %s AS ENUM (%s);", name, labels)
+		objects = append(objects, schemaObject{name: name, ddl: ddl})
+	}
+	return objects, rows.Err()
+}
+
+// dumpTables keeps the columns of every table in the order they were defined.
+func dumpTables(ctx context.Context, db Executor) ([]schemaObject, error) {
+	rows, err := db.QueryContext(ctx, _sqlDumpColumns)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := []string{}
+	columns := map[string][]string{}
+	for rows.Next() {
+		var table, name, dataType, def string
+		var notNull bool
+		if err := rows.Scan(&table, &name, &dataType, &notNull, &def); err != nil {
+			return nil, err
+		}
+
+		column := "    " + name + " " + dataType
+		if def != "" {
+			column += " DEFAULT " + def
+		}
+		if notNull {
+			column += " NOT NULL"
+		}
+		if _, ok := columns[table]; !ok {
+			tables = append(tables, table)
+		}
+		columns[table] = append(columns[table], column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	objects := make([]schemaObject, len(tables))
+	for i, table := range tables {
+		ddl := fmt.Sprintf("CREATE TABLE %s (\n%s\n);", table, strings.Join(columns[table], ",\n"))
+		objects[i] = schemaObject{name: table, ddl: ddl}
+	}
+	return objects, nil
+}
+
+func dumpConstraints(ctx context.Context, db Executor) ([]schemaObject, error) {
+	return queryObjects(ctx, db, _sqlDumpConstraints+"('p', 'u', 'c', 'x')", constraintDDL)
+}
+
+func dumpForeignKeys(ctx context.Context, db Executor) ([]schemaObject, error) {
+	return queryObjects(ctx, db, _sqlDumpConstraints+"('f')", constraintDDL)
+}
+
+func constraintDDL(table, name, def string) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s;", table, name, def)
+}
+
+func dumpIndexes(ctx context.Context, db Executor) ([]schemaObject, error) {
+	return queryObjects(ctx, db, _sqlDumpIndexes, func(table, name, def string) string {
+		return def + ";"
+	})
+}
+
+// dumpFunctions sorts overloaded functions by their arguments.
+func dumpFunctions(ctx context.Context, db Executor) ([]schemaObject, error) {
+	return queryObjects(ctx, db, _sqlDumpFunctions, func(name, args, def string) string {
+		return strings.TrimSpace(def) + ";"
+	})
+}
@@ -0,0 +1,38 @@
+package makoto
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrCollectionNotFound    = errors.New("migration collection not found")
+	ErrTargetVersionNotFound = errors.New("target version not found in migration collection")
+	ErrDatabaseAhead         = errors.New("database schema version is ahead of target version")
+	ErrDatabaseBehind        = errors.New("database schema version is behind target version")
+	ErrInvalidFilename       = errors.New("invalid migration filename")
+	ErrDuplicateVersion      = errors.New("duplicate migration version")
+	ErrInvalidTxMode         = errors.New("invalid transaction mode")
+	ErrDirty                 = errors.New("database is dirty, fix it by hand and run force")
+	ErrOutOfOrder            = errors.New("pending migrations older than the latest applied one, allow out of order to apply them")
+	ErrHistoryNotEmpty       = errors.New("schema_version already has applied migrations")
+	ErrLockTimeout           = errors.New("timed out waiting for migration lock")
+	ErrUnknownDialect        = errors.New("unknown sql dialect")
+	ErrDumpNotSupported      = errors.New("schema dump is not supported by the sql dialect")
+)
+
+// MigrationError is returned when a migration script fails to run.
+type MigrationError struct {
+	Version  int
+	Filename string
+	Exectype string
+	Err      error
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("migrate %s %s: %v", e.Exectype, e.Filename, e.Err)
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,109 @@
+package makoto
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// checkDirty refuses to continue while the latest record is dirty.
+func (m *Migrator) checkDirty(ctx context.Context, db Executor) error {
+	record, err := m.lastRecord(ctx, db)
+	if err == ErrRecordNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if record.Dirty() {
+		err = fmt.Errorf("%w: %s %s %s", ErrDirty, record.Exectype, record.Filename, record.Status)
+		if record.Error != "" {
+			err = fmt.Errorf("%w: %s", err, record.Error)
+		}
+		return err
+	}
+	return nil
+}
+
+// Force marks every script up to and including version as applied and every
+// later one as reverted, without running any of them. Use it to resolve a
+// dirty state after fixing the database by hand. A version of 0 marks
+// everything as reverted.
+func (m *Migrator) Force(version int) error {
+	return m.ForceContext(context.Background(), version)
+}
+
+// ForceContext is like Force but runs every database call with ctx.
+func (m *Migrator) ForceContext(ctx context.Context, version int) error {
+	return m.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		return m.force(ctx, conn, version)
+	})
+}
+
+func (m *Migrator) force(ctx context.Context, conn *sql.Conn, version int) error {
+	collection, err := m.Collection()
+	if err != nil {
+		return err
+	}
+	if version != 0 && collection.Find(version) == nil {
+		return ErrTargetVersionNotFound
+	}
+
+	h, err := m.loadHistory(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	written := 0
+
+	// revert the later versions, latest first
+	versions := h.versions()
+	for i := len(versions) - 1; i >= 0 && versions[i] > version; i-- {
+		v := versions[i]
+		record, _ := h.record(v)
+		if _, err := addRecord(ctx, m.dialect, tx, v, record.Filename, record.Checksum, ExecDOWN, "", StatusForced); err != nil {
+			return err
+		}
+		written++
+	}
+
+	// apply the missing versions, the target version is always recorded so
+	// the latest record is no longer dirty
+	for item := collection.Head(); item != nil; item = item.Next() {
+		st := item.Statement()
+		if st.Version > version {
+			break
+		}
+		if h.isApplied(st.Version) && st.Version != version {
+			continue
+		}
+		if _, err := addRecord(ctx, m.dialect, tx, st.Version, st.Filename, st.Checksum, ExecUP, "", StatusForced); err != nil {
+			return err
+		}
+		written++
+	}
+
+	// nothing to revert or apply, record the dirty version as reverted
+	if written == 0 {
+		last, err := getLastRecord(ctx, tx)
+		if err != nil && err != ErrRecordNotFound {
+			return err
+		}
+		if last != nil && last.Dirty() {
+			if _, err := addRecord(ctx, m.dialect, tx, last.Version, last.Filename, last.Checksum, ExecDOWN, "", StatusForced); err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Println("Force schema version: ", version)
+	return tx.Commit()
+}
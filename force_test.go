@@ -0,0 +1,97 @@
+package makoto
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestForceAfterFailedScript(t *testing.T) {
+	m, db := newTestMigrator(t, fstest.MapFS{
+		"1_a.sql": createTable("a"),
+		// creates b, then fails
+		"2_b.sql": script("CREATE TABLE b (id integer); INSERT INTO missing VALUES (1);", "DROP TABLE b;"),
+	})
+	m.SetTxMode(TxModeNone)
+
+	var migrationErr *MigrationError
+	if err := m.MigrateToHead(); !errors.As(err, &migrationErr) || migrationErr.Version != 2 {
+		t.Fatalf("MigrateToHead() error = %v, want a MigrationError of version 2", err)
+	}
+	assertApplied(t, m, 1)
+	assertTables(t, db, "a", "b")
+
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Dirty {
+		t.Error("Status().Dirty = false after a failed script")
+	}
+	records := allRecords(t, m)
+	if last := records[len(records)-1]; last.Status != StatusFailed || last.Error == "" {
+		t.Errorf("last record = %+v, want failed with its error", last)
+	}
+	if err := m.MigrateToHead(); !errors.Is(err, ErrDirty) {
+		t.Fatalf("MigrateToHead() on a dirty database error = %v, want %v", err, ErrDirty)
+	}
+
+	// revert the partial script by hand and mark the database at version 1
+	if _, err := db.Exec("DROP TABLE b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Force(1); err != nil {
+		t.Fatal(err)
+	}
+	status, err = m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Dirty || status.Version != 1 {
+		t.Errorf("Status() = version %v dirty %v, want version 1 not dirty", status.Version, status.Dirty)
+	}
+
+	// the fixed script applies
+	setTestCollection(t, m, fstest.MapFS{
+		"1_a.sql": createTable("a"),
+		"2_b.sql": createTable("b"),
+	})
+	if err := m.MigrateToHead(); err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, m, 1, 2)
+	assertTables(t, db, "a", "b")
+}
+
+func TestForceVersion(t *testing.T) {
+	m, db := newTestMigrator(t, fstest.MapFS{
+		"1_a.sql": createTable("a"),
+		"2_b.sql": createTable("b"),
+		"3_c.sql": createTable("c"),
+	})
+	if err := m.MigrateTo(2); err != nil {
+		t.Fatal(err)
+	}
+
+	// force runs no script, it only writes records
+	if err := m.Force(3); err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, m, 1, 2, 3)
+	assertTables(t, db, "a", "b")
+
+	if err := m.Force(1); err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, m, 1)
+	assertTables(t, db, "a", "b")
+
+	if err := m.Force(0); err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, m)
+
+	if err := m.Force(4); !errors.Is(err, ErrTargetVersionNotFound) {
+		t.Errorf("Force(4) error = %v, want %v", err, ErrTargetVersionNotFound)
+	}
+}
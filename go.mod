@@ -4,9 +4,12 @@ go 1.18
 
 require (
 	github.com/BurntSushi/toml v1.2.0
+	github.com/go-sql-driver/mysql v1.6.0
 	github.com/lib/pq v1.10.7
+	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/olekukonko/tablewriter v0.0.5
 	github.com/urfave/cli/v2 v2.16.3
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,182 @@
+package makoto
+
+import (
+	"context"
+	"sort"
+)
+
+// history is the applied set replayed from every schema_version record. An up
+// record applies its version and a down record reverts it, so the applied set
+// stays exact however many times a version went up and down.
+type history struct {
+	applied map[int]MigrationRecord
+	// latest record of every repeatable script by filename
+	repeated map[string]MigrationRecord
+	// squashed scripts whose replaced versions are only partly applied
+	partial []int
+}
+
+// newHistory replays the records in id order. Dirty records never change the
+// applied set. The squashed scripts of collection, which may be nil, stand in
+// for the versions they replaced.
+func newHistory(records []MigrationRecord, collection *MigrationCollection) *history {
+	h := &history{
+		applied:  map[int]MigrationRecord{},
+		repeated: map[string]MigrationRecord{},
+	}
+	squashes := squashRanges(collection)
+	for _, record := range records {
+		if record.Dirty() {
+			continue
+		}
+		switch record.Exectype {
+		case ExecUP:
+			h.applied[record.Version] = record
+		case ExecDOWN:
+			delete(h.applied, record.Version)
+			// reverting a squashed script reverts everything it replaced
+			if from, ok := squashes[record.Version]; ok {
+				h.revertRange(from, record.Version)
+			}
+		case ExecREPEAT:
+			h.repeated[record.Filename] = record
+		}
+	}
+	h.squash(collection, squashes)
+	return h
+}
+
+// squashRanges maps the version of every squashed script to the first
+// version it replaced.
+func squashRanges(collection *MigrationCollection) map[int]int {
+	squashes := map[int]int{}
+	if collection == nil {
+		return squashes
+	}
+	from := 0
+	for item := collection.Head(); item != nil; item = item.Next() {
+		st := item.Statement()
+		if st.Squash {
+			squashes[st.Version] = from
+		}
+		from = st.Version + 1
+	}
+	return squashes
+}
+
+func (h *history) revertRange(from, to int) {
+	for version := range h.applied {
+		if version >= from && version <= to {
+			delete(h.applied, version)
+		}
+	}
+}
+
+// squash folds the versions replaced by a squashed script into the script
+// once the database reached its version, so databases migrated before the
+// squash are already up to date.
+func (h *history) squash(collection *MigrationCollection, squashes map[int]int) {
+	for version, from := range squashes {
+		record, ok := h.applied[version]
+		if !ok {
+			for applied := range h.applied {
+				if applied >= from && applied < version {
+					h.partial = append(h.partial, version)
+					break
+				}
+			}
+			continue
+		}
+
+		h.revertRange(from, version-1)
+		st := collection.FindStatement(version)
+		if record.Filename != st.Filename {
+			record.Filename = st.Filename
+			record.Checksum = st.Checksum
+		}
+		h.applied[version] = record
+	}
+	sort.Ints(h.partial)
+}
+
+func (h *history) isApplied(version int) bool {
+	_, ok := h.applied[version]
+	return ok
+}
+
+// record returns the latest up record of an applied version.
+func (h *history) record(version int) (MigrationRecord, bool) {
+	record, ok := h.applied[version]
+	return record, ok
+}
+
+// latest returns the highest applied version, 0 when nothing is applied.
+func (h *history) latest() int {
+	latest := 0
+	for version := range h.applied {
+		if version > latest {
+			latest = version
+		}
+	}
+	return latest
+}
+
+// versions returns the applied versions in ascending order.
+func (h *history) versions() []int {
+	versions := make([]int, 0, len(h.applied))
+	for version := range h.applied {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// repeatRecord returns the latest record of a repeatable script.
+func (h *history) repeatRecord(filename string) (MigrationRecord, bool) {
+	record, ok := h.repeated[filename]
+	return record, ok
+}
+
+// records returns the latest up record of every applied version, ordered by
+// version.
+func (h *history) records() []MigrationRecord {
+	records := make([]MigrationRecord, 0, len(h.applied))
+	for _, version := range h.versions() {
+		records = append(records, h.applied[version])
+	}
+	return records
+}
+
+// loadHistory replays the schema_version records, without the table the
+// history is empty.
+func (m *Migrator) loadHistory(ctx context.Context, db Executor) (*history, error) {
+	exists, err := m.dialect.HasTable(ctx, db, "schema_version")
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return newHistory(nil, m.collection), nil
+	}
+
+	records, err := getAllRecords(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return newHistory(records, m.collection), nil
+}
+
+// Applied returns the up record of every applied version, ordered by version.
+// It replays the whole schema_version history, so versions that were
+// reverted are left out.
+func (m *Migrator) Applied() ([]MigrationRecord, error) {
+	return m.AppliedContext(context.Background())
+}
+
+// AppliedContext is like Applied but runs every database call with ctx.
+func (m *Migrator) AppliedContext(ctx context.Context) ([]MigrationRecord, error) {
+	h, err := m.loadHistory(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+	return h.records(), nil
+}
@@ -0,0 +1,265 @@
+package makoto
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newRecord(version int, exectype, status string) MigrationRecord {
+	return MigrationRecord{
+		Version:  version,
+		Filename: "script",
+		Exectype: exectype,
+		Status:   status,
+	}
+}
+
+func TestNewHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		records  []MigrationRecord
+		versions []int
+		latest   int
+	}{
+		{
+			name:     "empty",
+			records:  nil,
+			versions: []int{},
+			latest:   0,
+		},
+		{
+			name: "up",
+			records: []MigrationRecord{
+				newRecord(1, ExecUP, StatusSucceeded),
+				newRecord(2, ExecUP, StatusSucceeded),
+			},
+			versions: []int{1, 2},
+			latest:   2,
+		},
+		{
+			name: "up and down",
+			records: []MigrationRecord{
+				newRecord(1, ExecUP, StatusSucceeded),
+				newRecord(2, ExecUP, StatusSucceeded),
+				newRecord(2, ExecDOWN, StatusSucceeded),
+			},
+			versions: []int{1},
+			latest:   1,
+		},
+		{
+			name: "up down up",
+			records: []MigrationRecord{
+				newRecord(1, ExecUP, StatusSucceeded),
+				newRecord(1, ExecDOWN, StatusSucceeded),
+				newRecord(1, ExecUP, StatusSucceeded),
+				newRecord(2, ExecUP, StatusSucceeded),
+				newRecord(2, ExecDOWN, StatusSucceeded),
+			},
+			versions: []int{1},
+			latest:   1,
+		},
+		{
+			name: "down out of order",
+			records: []MigrationRecord{
+				newRecord(1, ExecUP, StatusSucceeded),
+				newRecord(3, ExecUP, StatusSucceeded),
+				newRecord(2, ExecUP, StatusSucceeded),
+				newRecord(3, ExecDOWN, StatusSucceeded),
+			},
+			versions: []int{1, 2},
+			latest:   2,
+		},
+		{
+			name: "started",
+			records: []MigrationRecord{
+				newRecord(1, ExecUP, StatusSucceeded),
+				newRecord(2, ExecUP, StatusStarted),
+			},
+			versions: []int{1},
+			latest:   1,
+		},
+		{
+			name: "failed down",
+			records: []MigrationRecord{
+				newRecord(1, ExecUP, StatusSucceeded),
+				newRecord(2, ExecUP, StatusSucceeded),
+				newRecord(2, ExecDOWN, StatusFailed),
+			},
+			versions: []int{1, 2},
+			latest:   2,
+		},
+		{
+			name: "forced after failure",
+			records: []MigrationRecord{
+				newRecord(1, ExecUP, StatusSucceeded),
+				newRecord(2, ExecUP, StatusFailed),
+				newRecord(2, ExecUP, StatusForced),
+			},
+			versions: []int{1, 2},
+			latest:   2,
+		},
+		{
+			name: "forced down",
+			records: []MigrationRecord{
+				newRecord(1, ExecUP, StatusSucceeded),
+				newRecord(2, ExecUP, StatusSucceeded),
+				newRecord(2, ExecDOWN, StatusForced),
+			},
+			versions: []int{1},
+			latest:   1,
+		},
+		{
+			name: "baseline",
+			records: []MigrationRecord{
+				newRecord(1, ExecUP, StatusBaseline),
+				newRecord(2, ExecUP, StatusBaseline),
+				newRecord(3, ExecUP, StatusSucceeded),
+			},
+			versions: []int{1, 2, 3},
+			latest:   3,
+		},
+		{
+			name: "repeatable",
+			records: []MigrationRecord{
+				newRecord(1, ExecUP, StatusSucceeded),
+				newRecord(0, ExecREPEAT, StatusSucceeded),
+			},
+			versions: []int{1},
+			latest:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHistory(tt.records, nil)
+			if got := h.versions(); !reflect.DeepEqual(got, tt.versions) {
+				t.Errorf("versions() = %v, want %v", got, tt.versions)
+			}
+			if got := h.latest(); got != tt.latest {
+				t.Errorf("latest() = %v, want %v", got, tt.latest)
+			}
+		})
+	}
+}
+
+func TestNewHistoryRecords(t *testing.T) {
+	records := []MigrationRecord{
+		{Version: 1, Filename: "1_a.sql", Checksum: "a", Exectype: ExecUP, Status: StatusSucceeded},
+		{Version: 1, Filename: "1_a.sql", Checksum: "a", Exectype: ExecDOWN, Status: StatusSucceeded},
+		{Version: 1, Filename: "1_a.sql", Checksum: "b", Exectype: ExecUP, Status: StatusSucceeded},
+		{Version: 0, Filename: "R_view.sql", Checksum: "c", Exectype: ExecREPEAT, Status: StatusSucceeded},
+		{Version: 0, Filename: "R_view.sql", Checksum: "d", Exectype: ExecREPEAT, Status: StatusSucceeded},
+	}
+	h := newHistory(records, nil)
+
+	// the latest up record of a version is the applied one
+	if record, ok := h.record(1); !ok || record.Checksum != "b" {
+		t.Errorf("record(1) = %+v, %v, want checksum b", record, ok)
+	}
+	if h.isApplied(0) {
+		t.Error("repeatable records applied version 0")
+	}
+	if record, ok := h.repeatRecord("R_view.sql"); !ok || record.Checksum != "d" {
+		t.Errorf("repeatRecord() = %+v, %v, want checksum d", record, ok)
+	}
+	if got := h.records(); len(got) != 1 || got[0].Checksum != "b" {
+		t.Errorf("records() = %+v, want the record with checksum b", got)
+	}
+}
+
+func TestNewHistorySquash(t *testing.T) {
+	// 3_squashed.sql replaced the scripts 1 to 3
+	collection := &MigrationCollection{}
+	collection.Add(&MigrateStatement{Version: 3, Filename: "3_squashed.sql", Checksum: "squashed", Squash: true})
+	collection.Add(&MigrateStatement{Version: 4, Filename: "4_d.sql", Checksum: "d"})
+
+	tests := []struct {
+		name     string
+		records  []MigrationRecord
+		versions []int
+		partial  []int
+	}{
+		{
+			name:     "empty",
+			records:  nil,
+			versions: []int{},
+		},
+		{
+			name: "full history",
+			records: []MigrationRecord{
+				newRecord(1, ExecUP, StatusSucceeded),
+				newRecord(2, ExecUP, StatusSucceeded),
+				newRecord(3, ExecUP, StatusSucceeded),
+			},
+			versions: []int{3},
+		},
+		{
+			name: "full history and later",
+			records: []MigrationRecord{
+				newRecord(1, ExecUP, StatusSucceeded),
+				newRecord(2, ExecUP, StatusSucceeded),
+				newRecord(3, ExecUP, StatusSucceeded),
+				newRecord(4, ExecUP, StatusSucceeded),
+			},
+			versions: []int{3, 4},
+		},
+		{
+			name: "partial history",
+			records: []MigrationRecord{
+				newRecord(1, ExecUP, StatusSucceeded),
+				newRecord(2, ExecUP, StatusSucceeded),
+			},
+			versions: []int{1, 2},
+			partial:  []int{3},
+		},
+		{
+			name: "squashed script",
+			records: []MigrationRecord{
+				newRecord(3, ExecUP, StatusSucceeded),
+			},
+			versions: []int{3},
+		},
+		{
+			name: "squashed script down",
+			records: []MigrationRecord{
+				newRecord(1, ExecUP, StatusSucceeded),
+				newRecord(2, ExecUP, StatusSucceeded),
+				newRecord(3, ExecUP, StatusSucceeded),
+				newRecord(3, ExecDOWN, StatusSucceeded),
+			},
+			versions: []int{},
+		},
+		{
+			name: "squashed script down and up",
+			records: []MigrationRecord{
+				newRecord(1, ExecUP, StatusSucceeded),
+				newRecord(2, ExecUP, StatusSucceeded),
+				newRecord(3, ExecUP, StatusSucceeded),
+				newRecord(3, ExecDOWN, StatusSucceeded),
+				newRecord(3, ExecUP, StatusSucceeded),
+			},
+			versions: []int{3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHistory(tt.records, collection)
+			if got := h.versions(); !reflect.DeepEqual(got, tt.versions) {
+				t.Errorf("versions() = %v, want %v", got, tt.versions)
+			}
+			if !reflect.DeepEqual(h.partial, tt.partial) {
+				t.Errorf("partial = %v, want %v", h.partial, tt.partial)
+			}
+		})
+	}
+
+	// the folded record matches the squashed script, so it does not drift
+	h := newHistory([]MigrationRecord{
+		{Version: 1, Filename: "1_a.sql", Checksum: "a", Exectype: ExecUP, Status: StatusSucceeded},
+		{Version: 3, Filename: "3_c.sql", Checksum: "c", Exectype: ExecUP, Status: StatusSucceeded},
+	}, collection)
+	if record, ok := h.record(3); !ok || record.Filename != "3_squashed.sql" || record.Checksum != "squashed" {
+		t.Errorf("record(3) = %+v, %v, want the squashed script", record, ok)
+	}
+}
@@ -0,0 +1,170 @@
+package makoto
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	DefaultLockTimeout = 15 * time.Second
+	// DefaultLockLease is how long a lock row of schema_lock is held before
+	// other migrators treat it as left behind by a crashed one
+	DefaultLockLease = 10 * time.Minute
+
+	lockRetryInterval = 250 * time.Millisecond
+
+	// the lock table of dialects without session locks, the row with id 1 is
+	// the lock. locked_at is written in UTC by the migrator so it compares
+	// with the lease the same way on every driver, placeholders are rebound
+	// to the dialect.
+	_sqlCreateLockTable = `
+	CREATE TABLE IF NOT EXISTS schema_lock (
+		id integer PRIMARY KEY,
+		locked_at timestamp DEFAULT CURRENT_TIMESTAMP
+	)`
+	_sqlLockTable      = `INSERT INTO schema_lock (id, locked_at) VALUES (1, ?) ON CONFLICT DO NOTHING`
+	_sqlUnlockTable    = `DELETE FROM schema_lock WHERE id = 1`
+	_sqlBreakLockTable = `DELETE FROM schema_lock WHERE id = 1 AND locked_at < ?`
+)
+
+// LockBreaker is implemented by dialects whose lock outlives the session that
+// took it, like the row of the schema_lock table.
+type LockBreaker interface {
+	// BreakLock releases the lock if it was taken more than lease ago and
+	// reports whether it did.
+	BreakLock(ctx context.Context, conn *sql.Conn, lease time.Duration) (bool, error)
+}
+
+// SetLockTimeout sets how long a migration waits for other migrators to
+// release the lock. A timeout of zero or less waits until ctx is done.
+func (m *Migrator) SetLockTimeout(timeout time.Duration) {
+	m.lockTimeout = timeout
+}
+
+// SetLockLease sets how long the lock of a dialect without session locks is
+// held before other migrators break it, so a migrator that crashed holding
+// the lock does not block migrations forever. The lease has to be longer than
+// the longest migration. A lease of zero or less never breaks the lock.
+func (m *Migrator) SetLockLease(lease time.Duration) {
+	m.lockLease = lease
+}
+
+// withLock runs fn while holding the migration lock of the dialect. fn gets
+// the connection holding the lock and runs every database call on it, with a
+// pool of a single connection any other call would wait for the lock forever.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) (err error) {
+	// locks may belong to a session, so the lock and unlock have to run on
+	// the same connection
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := acquireLock(ctx, m.dialect, conn, m.lockTimeout, m.lockLease); err != nil {
+		return err
+	}
+	defer func() {
+		// a lock left behind blocks the next migrations, report it even
+		// when fn succeeded
+		if unlockErr := releaseLock(m.dialect, conn); unlockErr != nil {
+			log.Println("Release migration lock, Error: ", unlockErr)
+			if err == nil {
+				err = fmt.Errorf("release migration lock: %w", unlockErr)
+			}
+		}
+	}()
+
+	return fn(conn)
+}
+
+// withMigrationLock is like withLock but creates or upgrades the
+// schema_version table before fn runs, plans only read it.
+func (m *Migrator) withMigrationLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		if err := createSchemaVersionTable(ctx, m.dialect, conn); err != nil {
+			return err
+		}
+		return fn(conn)
+	})
+}
+
+func acquireLock(ctx context.Context, d Dialect, conn *sql.Conn, timeout, lease time.Duration) error {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	ticker := time.NewTicker(lockRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		locked, err := d.TryLock(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return nil
+		}
+
+		if breaker, ok := d.(LockBreaker); ok && lease > 0 {
+			broken, err := breaker.BreakLock(ctx, conn, lease)
+			if err != nil {
+				return err
+			}
+			if broken {
+				log.Println("Break migration lock held longer than ", lease)
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return fmt.Errorf("%w after %v", ErrLockTimeout, timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+func releaseLock(d Dialect, conn *sql.Conn) error {
+	// release even when the migration context was cancelled
+	return d.Unlock(context.Background(), conn)
+}
+
+// tryLockTable takes the lock by inserting the lock row into schema_lock. The
+// row outlives the session, so a migrator that crashed holding the lock leaves
+// it behind until its lease is over and breakLockTable deletes it.
+func tryLockTable(ctx context.Context, d Dialect, conn *sql.Conn) (bool, error) {
+	if _, err := conn.ExecContext(ctx, _sqlCreateLockTable); err != nil {
+		return false, err
+	}
+	result, err := conn.ExecContext(ctx, rebind(d, _sqlLockTable), time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func unlockTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, _sqlUnlockTable)
+	return err
+}
+
+// breakLockTable deletes the lock row if it is older than lease. Only the
+// stale row matches, a migrator that took the lock in the meantime keeps it.
+func breakLockTable(ctx context.Context, d Dialect, conn *sql.Conn, lease time.Duration) (bool, error) {
+	result, err := conn.ExecContext(ctx, rebind(d, _sqlBreakLockTable), time.Now().UTC().Add(-lease))
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
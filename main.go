@@ -1,28 +1,44 @@
 package makoto
 
 import (
-	"bytes"
+	"context"
 	"database/sql"
 	"embed"
+	"errors"
+	"io/fs"
 	"log"
-	"path"
+	"time"
 )
 
 type Migrator struct {
-	db         *sql.DB
-	collection *MigrationCollection
+	db          *sql.DB
+	collection  *MigrationCollection
+	lockTimeout time.Duration
+	lockLease   time.Duration
+	ignoreDrift bool
+	outOfOrder  bool
+	txMode      TxMode
+	dialect     Dialect
 }
 
 func GetMigrator(db *sql.DB, collection *MigrationCollection) *Migrator {
 	return &Migrator{
-		db:         db,
-		collection: collection,
+		db:          db,
+		collection:  collection,
+		lockTimeout: DefaultLockTimeout,
+		lockLease:   DefaultLockLease,
+		txMode:      TxModeAll,
+		dialect:     Postgres,
 	}
 }
 
 func New(db *sql.DB) *Migrator {
 	return &Migrator{
-		db: db,
+		db:          db,
+		lockTimeout: DefaultLockTimeout,
+		lockLease:   DefaultLockLease,
+		txMode:      TxModeAll,
+		dialect:     Postgres,
 	}
 }
 
@@ -30,226 +46,454 @@ func (m *Migrator) Close() {
 	m.db.Close()
 }
 
+// Deprecated: use Collection.
 func (m *Migrator) GetCollection() *MigrationCollection {
-	if m.collection != nil {
-		return m.collection
+	collection, err := m.Collection()
+	if err != nil {
+		log.Fatal(err)
 	}
-	log.Fatal("Migration collection not found")
-	return nil
+	return collection
+}
+
+func (m *Migrator) Collection() (*MigrationCollection, error) {
+	if m.collection == nil {
+		return nil, ErrCollectionNotFound
+	}
+	return m.collection, nil
 }
 
 func (m *Migrator) SetCollection(c *MigrationCollection) {
 	m.collection = c
 }
 
+// Deprecated: use LoadEmbedCollection.
 func (m *Migrator) SetEmbedCollection(fs embed.FS) {
-	m.collection = &MigrationCollection{}
-
-	fnames, err := getAllFilenames(&fs, "")
-	if err != nil {
+	if err := m.LoadEmbedCollection(fs); err != nil {
 		panic(err)
 	}
+}
 
-	for _, fname := range fnames {
-		data, err := fs.ReadFile(fname)
-		if err != nil {
-			panic(err)
-		}
-		reader := bytes.NewReader(data)
-		statement := ParseMigrationStatement(fname, reader)
-		m.collection.Add(statement)
+// LoadEmbedCollection sets the collection to the sql scripts of fs, named by
+// their path from the root of fs.
+func (m *Migrator) LoadEmbedCollection(fs embed.FS) error {
+	return m.SetFSCollection(fs, ".")
+}
+
+// SetFSCollection sets the collection to the sql scripts in dir of fsys, see
+// LoadCollection.
+func (m *Migrator) SetFSCollection(fsys fs.FS, dir string) error {
+	collection, err := LoadCollection(fsys, dir)
+	if err != nil {
+		return err
 	}
+	m.collection = collection
+	return nil
 }
 
+// Deprecated: use MigrateTo.
 func (m *Migrator) EnsureSchema(targetVersion int) {
-	currentNode, err := m.getCurrentNode()
-	if err != nil && err != ErrRecordNotFound {
+	logResult(m.MigrateTo(targetVersion))
+}
+
+// Deprecated: use MigrateToHead.
+func (m *Migrator) EnsureHead() {
+	logResult(m.MigrateToHead())
+}
+
+// Deprecated: use Rollback.
+func (m *Migrator) Down(targetVersion int) {
+	logResult(m.Rollback(targetVersion))
+}
+
+// Deprecated: use Drop.
+func (m *Migrator) DropAll() {
+	logResult(m.Drop())
+}
+
+// logResult keeps the behaviour of the deprecated API, which only logged
+// when the database was out of step with the target version.
+func logResult(err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrDatabaseAhead), errors.Is(err, ErrDatabaseBehind):
+		log.Println(err)
+	default:
 		log.Fatal(err)
 	}
+}
+
+// MigrateTo applies all pending migrations up to and including targetVersion.
+func (m *Migrator) MigrateTo(targetVersion int) error {
+	return m.EnsureSchemaContext(context.Background(), targetVersion)
+}
 
-	targetNode := m.collection.Find(targetVersion)
-	if targetNode == nil {
-		log.Fatal("Target version not exists")
+// EnsureSchemaContext is like MigrateTo but runs every database call with ctx.
+// Cancelling ctx rolls back the migration transaction.
+func (m *Migrator) EnsureSchemaContext(ctx context.Context, targetVersion int) error {
+	return m.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		return m.ensureSchema(ctx, conn, targetVersion)
+	})
+}
+
+func (m *Migrator) ensureSchema(ctx context.Context, conn *sql.Conn, targetVersion int) error {
+	items, err := m.planUp(ctx, conn, targetVersion)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		log.Println("Schema version is already up to date")
+		return nil
 	}
 
-	if err == ErrRecordNotFound {
-		currentNode = m.GetCollection().Head()
-		m.upto(currentNode, targetVersion)
-		return
+	log.Println("Start migration")
+	return m.execute(ctx, conn, items, ExecUP)
+}
+
+// planUp returns the scripts that migrate the database up to targetVersion.
+// At the head of the collection the new and changed repeatable scripts follow
+// the versioned ones.
+func (m *Migrator) planUp(ctx context.Context, db Executor, targetVersion int) ([]*migrationItem, error) {
+	if err := m.checkState(ctx, db); err != nil {
+		return nil, err
 	}
 
-	st := currentNode.Statement()
-	if st.Version == targetVersion {
-		log.Println("Schema version is already up to date")
-		return
+	collection, err := m.Collection()
+	if err != nil {
+		return nil, err
 	}
-	if st.Version < targetVersion {
-		log.Println("Start migration")
-		m.upto(currentNode.nextNode, targetVersion)
-	} else {
-		log.Println("Database schema version is ahead of migration script")
+
+	// a collection without versioned scripts is at its head at version 0
+	lastStatement := collection.LastStatement()
+	atHead := (lastStatement == nil && targetVersion == 0) ||
+		(lastStatement != nil && lastStatement.Version == targetVersion)
+
+	targetNode := collection.Find(targetVersion)
+	if targetNode == nil && !atHead {
+		return nil, ErrTargetVersionNotFound
 	}
-}
 
-func (m *Migrator) DropAll() {
-	currentNode, err := m.getCurrentNode()
-	if err != nil && err != ErrRecordNotFound {
-		log.Fatal(err)
+	h, err := m.loadHistory(ctx, db)
+	if err != nil {
+		return nil, err
 	}
-	m.downTo(currentNode, 0, true)
+	if h.latest() > targetVersion {
+		return nil, ErrDatabaseAhead
+	}
+
+	if err := m.checkOutOfOrder(collection, h, targetVersion); err != nil {
+		return nil, err
+	}
+
+	items := upTo(collection, h, targetVersion)
+	if atHead {
+		items = append(items, repeatables(collection, h)...)
+	}
+	return items, nil
 }
 
-func (m *Migrator) Down(targetVersion int) {
-	currentNode, err := m.getCurrentNode()
-	if err != nil && err != ErrRecordNotFound {
-		log.Fatal(err)
+// MigrateToHead applies all pending migrations in the collection.
+func (m *Migrator) MigrateToHead() error {
+	return m.EnsureHeadContext(context.Background())
+}
+
+// EnsureHeadContext is like MigrateToHead but runs every database call with ctx.
+func (m *Migrator) EnsureHeadContext(ctx context.Context) error {
+	collection, err := m.Collection()
+	if err != nil {
+		return err
 	}
 
-	targetNode := m.collection.Find(targetVersion)
-	if targetNode == nil {
-		log.Fatal("Target version not exists")
+	lastStatement := collection.LastStatement()
+	if lastStatement == nil {
+		if len(collection.Repeatables()) == 0 {
+			return nil
+		}
+		return m.EnsureSchemaContext(ctx, 0)
 	}
+	return m.EnsureSchemaContext(ctx, lastStatement.Version)
+}
 
-	st := currentNode.Statement()
-	if st.Version <= targetVersion {
-		log.Println("Database schema version is behind target version")
-	} else {
-		m.downTo(currentNode, targetVersion, false)
+// Rollback reverts applied migrations until targetVersion is the latest one.
+func (m *Migrator) Rollback(targetVersion int) error {
+	return m.DownContext(context.Background(), targetVersion)
+}
+
+// DownContext is like Rollback but runs every database call with ctx.
+func (m *Migrator) DownContext(ctx context.Context, targetVersion int) error {
+	return m.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		return m.down(ctx, conn, targetVersion)
+	})
+}
+
+func (m *Migrator) down(ctx context.Context, conn *sql.Conn, targetVersion int) error {
+	items, err := m.planDown(ctx, conn, targetVersion, false)
+	if err != nil {
+		return err
 	}
+	if len(items) == 0 {
+		log.Println("Schema version is already up to date")
+		return nil
+	}
+	return m.execute(ctx, conn, items, ExecDOWN)
 }
 
-func (m *Migrator) getCurrentNode() (*migrationItem, error) {
-	// ensure schema version table exists
-	if err := createSchemaVersionTable(m.db); err != nil {
-		panic(err)
+// Drop reverts every applied migration.
+func (m *Migrator) Drop() error {
+	return m.DropAllContext(context.Background())
+}
+
+// DropAllContext is like Drop but runs every database call with ctx.
+func (m *Migrator) DropAllContext(ctx context.Context) error {
+	return m.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		return m.dropAll(ctx, conn)
+	})
+}
+
+func (m *Migrator) dropAll(ctx context.Context, conn *sql.Conn) error {
+	items, err := m.planDown(ctx, conn, 0, true)
+	if err != nil {
+		return err
+	}
+	return m.execute(ctx, conn, items, ExecDOWN)
+}
+
+// planDown returns the scripts that revert the database down to targetVersion,
+// or every applied script when dropAll is set.
+func (m *Migrator) planDown(ctx context.Context, db Executor, targetVersion int, dropAll bool) ([]*migrationItem, error) {
+	if err := m.checkState(ctx, db); err != nil {
+		return nil, err
+	}
+
+	collection, err := m.Collection()
+	if err != nil {
+		return nil, err
 	}
 
-	record, err := getLastRecord(m.db)
+	h, err := m.loadHistory(ctx, db)
 	if err != nil {
 		return nil, err
 	}
 
-	lastStatement := m.GetCollection().LastStatement()
-	if lastStatement != nil && record.Version > lastStatement.Version {
-		return m.GetCollection().Tail(), nil
+	if !dropAll {
+		targetNode := collection.Find(targetVersion)
+		if targetNode == nil {
+			return nil, ErrTargetVersionNotFound
+		}
+		if h.latest() < targetVersion {
+			return nil, ErrDatabaseBehind
+		}
 	}
-	return m.GetCollection().Find(record.Version), nil
+	return downTo(collection, h, targetVersion, dropAll), nil
 }
 
-func (m *Migrator) upto(currentNode *migrationItem, targetVersion int) {
-	tx, err := m.db.Begin()
-	if err != nil {
-		log.Fatal(err)
+// checkState refuses to plan migrations on a dirty or drifted database.
+func (m *Migrator) checkState(ctx context.Context, db Executor) error {
+	if err := m.checkDirty(ctx, db); err != nil {
+		return err
 	}
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-			log.Println("Rollback migration, Error: ", r)
+	return m.checkDrift(ctx, db)
+}
+
+// execute runs the scripts in order. In TxModeAll consecutive transactional
+// scripts share a transaction, scripts marked no-transaction always run and are
+// recorded on their own.
+func (m *Migrator) execute(ctx context.Context, conn *sql.Conn, items []*migrationItem, exectype string) error {
+	for len(items) > 0 {
+		if !m.runsInTx(items[0].Statement()) {
+			if err := m.runScriptNoTx(ctx, conn, items[0].Statement(), exectype); err != nil {
+				return err
+			}
+			items = items[1:]
+			continue
+		}
+
+		n := 1
+		for m.batchesScripts() && n < len(items) && m.runsInTx(items[n].Statement()) {
+			n++
+		}
+		batch := items[:n]
+		err := m.runInTx(ctx, conn, func(tx *sql.Tx) error {
+			return m.runScripts(ctx, tx, batch, exectype)
+		})
+		if err != nil {
+			return err
 		}
-	}()
+		items = items[n:]
+	}
+	return nil
+}
+
+// runsInTx reports whether the script runs inside a transaction, which needs
+// a dialect with transactional DDL.
+func (m *Migrator) runsInTx(statement *MigrateStatement) bool {
+	return !statement.NoTransaction && m.txMode != TxModeNone && m.dialect.TransactionalDDL()
+}
 
-	upTo(tx, currentNode, targetVersion)
-	tx.Commit()
+// batchesScripts reports whether consecutive scripts share a transaction.
+func (m *Migrator) batchesScripts() bool {
+	if single, ok := m.dialect.(SingleScriptTx); ok && single.SingleScriptTx() {
+		return false
+	}
+	return m.txMode == TxModeAll
 }
 
-func (m *Migrator) downTo(currentNode *migrationItem, targetVersion int, dropAll bool) {
-	tx, err := m.db.Begin()
+// runInTx runs fn in a transaction on conn, the connection holding the lock.
+func (m *Migrator) runInTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	preparer, ok := m.dialect.(TxPreparer)
+	if !ok {
+		return runTx(ctx, conn, fn, nil)
+	}
+
+	restore, err := preparer.PrepareTx(ctx, conn)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-			log.Println("Rollback migration, Error: ", r)
-		}
-	}()
+	err = runTx(ctx, conn, fn, preparer)
+	if restoreErr := restore(); err == nil {
+		err = restoreErr
+	}
+	return err
+}
 
-	downTo(tx, currentNode, targetVersion, dropAll)
-	tx.Commit()
+// txBeginner is satisfied by both *sql.DB and *sql.Conn
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 }
 
-func (m *Migrator) EnsureHead() {
-	lastStatement := m.GetCollection().LastStatement()
-	if lastStatement != nil {
-		m.EnsureSchema(lastStatement.Version)
+func runTx(ctx context.Context, db txBeginner, fn func(tx *sql.Tx) error, preparer TxPreparer) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
-}
 
-func upTo(tx *sql.Tx, node *migrationItem, targetVersion int) {
-	currentNode := node
-	for {
-		statement := currentNode.statement
-		if statement.Version <= targetVersion {
-			_, err := tx.Exec(statement.UpStatement)
-			if err != nil {
-				log.Println("Fail to run migration script: ", statement.Filename)
-				log.Fatal(err)
-			}
-			log.Println("Migrate script: ", statement.Filename)
-			err = addRecord(tx, statement.Version, statement.Filename, statement.Checksum, ExecUP, statement.UpStatement)
-			if err != nil {
-				log.Fatal(err)
-			}
-			if currentNode.nextNode == nil {
-				break
-			}
-			currentNode = currentNode.nextNode
-		} else {
-			break
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		log.Println("Rollback migration, Error: ", err)
+		return err
+	}
+	if preparer != nil {
+		if err := preparer.CheckTx(ctx, tx); err != nil {
+			tx.Rollback()
+			log.Println("Rollback migration, Error: ", err)
+			return err
 		}
 	}
+	return tx.Commit()
 }
 
-func downTo(tx *sql.Tx, node *migrationItem, targetVersion int, dropAll bool) {
-	currentNode := node
-	for {
-		statement := currentNode.statement
-		if statement.Version > targetVersion || dropAll {
-			_, err := tx.Exec(statement.DownStatement)
-			if err != nil {
-				log.Println("Fail to run migration script: ", statement.Filename)
-				log.Fatal(err)
-			}
-			log.Println("Migrate script: ", statement.Filename)
-			err = addRecord(tx, statement.Version, statement.Filename, statement.Checksum, ExecDOWN, statement.UpStatement)
-			if err != nil {
-				log.Fatal(err)
-			}
-			if currentNode.nextNode == nil {
-				break
-			}
-			currentNode = currentNode.previousNode
-		} else {
-			break
+func (m *Migrator) runScripts(ctx context.Context, tx *sql.Tx, items []*migrationItem, exectype string) error {
+	for _, item := range items {
+		if err := m.runScript(ctx, tx, item.Statement(), exectype); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
-func getAllFilenames(fs *embed.FS, dir string) (out []string, err error) {
-	if len(dir) == 0 {
-		dir = "."
+func (m *Migrator) runScript(ctx context.Context, tx *sql.Tx, statement *MigrateStatement, exectype string) error {
+	exectype = statement.exectype(exectype)
+	script := statement.Script(exectype)
+	if err := execStatement(ctx, tx, statement, exectype); err != nil {
+		return &MigrationError{statement.Version, statement.Filename, exectype, err}
 	}
+	log.Println("Migrate script: ", statement.Filename)
+	_, err := addRecord(ctx, m.dialect, tx, statement.Version, statement.Filename, statement.Checksum, exectype, script, StatusSucceeded)
+	return err
+}
 
-	entries, err := fs.ReadDir(dir)
+// runScriptNoTx records the script as started before running it, so a crash
+// or failure halfway leaves a dirty record behind.
+func (m *Migrator) runScriptNoTx(ctx context.Context, conn *sql.Conn, statement *MigrateStatement, exectype string) error {
+	exectype = statement.exectype(exectype)
+	script := statement.Script(exectype)
+	id, err := addRecord(ctx, m.dialect, conn, statement.Version, statement.Filename, statement.Checksum, exectype, script, StatusStarted)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	for _, entry := range entries {
-		fp := path.Join(dir, entry.Name())
-		if entry.IsDir() {
-			res, err := getAllFilenames(fs, fp)
-			if err != nil {
-				return nil, err
-			}
+	status, errText := StatusSucceeded, ""
+	var execErr error
+	if statement.IsFunc() {
+		// Go migrations always get a transaction to run in
+		execErr = m.runInTx(ctx, conn, func(tx *sql.Tx) error {
+			return execStatement(ctx, tx, statement, exectype)
+		})
+	} else {
+		_, execErr = conn.ExecContext(ctx, script)
+	}
+	if execErr != nil {
+		status, errText = StatusFailed, execErr.Error()
+	}
+
+	// record the outcome even when ctx was cancelled
+	if err := updateRecordStatus(context.Background(), m.dialect, conn, id, status, errText); err != nil {
+		return err
+	}
+	if execErr != nil {
+		return &MigrationError{statement.Version, statement.Filename, exectype, execErr}
+	}
+	log.Println("Migrate script: ", statement.Filename)
+	return nil
+}
 
-			out = append(out, res...)
+// execStatement runs the sql script or the Go function of the statement.
+func execStatement(ctx context.Context, tx *sql.Tx, statement *MigrateStatement, exectype string) error {
+	if statement.IsFunc() {
+		if fn := statement.Func(exectype); fn != nil {
+			return fn(ctx, tx)
+		}
+		return nil
+	}
 
-			continue
+	_, err := tx.ExecContext(ctx, statement.Script(exectype))
+	return err
+}
+
+// upTo returns the scripts that are not applied up to and including
+// targetVersion, in ascending order.
+func upTo(collection *MigrationCollection, h *history, targetVersion int) []*migrationItem {
+	items := []*migrationItem{}
+	for item := collection.Head(); item != nil; item = item.Next() {
+		if item.statement.Version > targetVersion {
+			break
+		}
+		if !h.isApplied(item.statement.Version) {
+			items = append(items, item)
 		}
+	}
+	return items
+}
 
-		out = append(out, fp)
+// repeatables returns the repeatable scripts that never ran or changed since
+// they last ran, in filename order.
+func repeatables(collection *MigrationCollection, h *history) []*migrationItem {
+	items := []*migrationItem{}
+	for _, st := range collection.Repeatables() {
+		if record, ok := h.repeatRecord(st.Filename); ok && record.Checksum == st.Checksum {
+			continue
+		}
+		items = append(items, &migrationItem{statement: *st})
 	}
+	return items
+}
 
-	return
+// downTo returns the applied scripts above targetVersion, or every applied
+// script when dropAll is set, in descending order.
+func downTo(collection *MigrationCollection, h *history, targetVersion int, dropAll bool) []*migrationItem {
+	items := []*migrationItem{}
+	versions := h.versions()
+	for i := len(versions) - 1; i >= 0; i-- {
+		version := versions[i]
+		if version <= targetVersion && !dropAll {
+			break
+		}
+
+		item := collection.Find(version)
+		if item == nil {
+			log.Println("Skip reverting version without script: ", version)
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
 }
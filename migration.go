@@ -1,7 +1,11 @@
 package makoto
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -9,6 +13,17 @@ const (
 	// execution type
 	ExecUP   = "up"
 	ExecDOWN = "down"
+	// a repeatable script ran because it is new or changed
+	ExecREPEAT = "repeat"
+
+	// record status
+	StatusStarted   = "started"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	// written by Force to resolve a dirty state
+	StatusForced = "forced"
+	// written by Baseline for scripts that were never run
+	StatusBaseline = "baseline"
 )
 
 type MigrationRecord struct {
@@ -18,9 +33,22 @@ type MigrationRecord struct {
 	Checksum  string
 	Statement string
 	Exectype  string
+	Status    string
+	Error     string
 	CreatedAt time.Time
 }
 
+// IsFunc reports whether the record is of a migration written in Go.
+func (record *MigrationRecord) IsFunc() bool {
+	return strings.HasPrefix(record.Checksum, funcChecksumPrefix)
+}
+
+// Dirty reports whether the migration of the record started or failed
+// without a transaction to roll it back.
+func (record *MigrationRecord) Dirty() bool {
+	return record.Status == StatusStarted || record.Status == StatusFailed
+}
+
 func (record *MigrationRecord) ScanRow(rows *sql.Rows) error {
 	return rows.Scan(
 		&record.ID,
@@ -29,15 +57,63 @@ func (record *MigrationRecord) ScanRow(rows *sql.Rows) error {
 		&record.Checksum,
 		&record.Exectype,
 		&record.Statement,
+		&record.Status,
+		&record.Error,
 		&record.CreatedAt)
 }
 
+// MigrateFunc is a migration written in Go, it runs in the transaction of the
+// migration.
+type MigrateFunc func(ctx context.Context, tx *sql.Tx) error
+
 type MigrateStatement struct {
 	Version       int
 	Filename      string
 	UpStatement   string
 	DownStatement string
 	Checksum      string
+	// run outside of a transaction, set by the "-- makoto:no-transaction" directive
+	NoTransaction bool
+	// a repeatable migration named R_[name].sql, or a seed with the
+	// "-- makoto:repeatable" directive
+	Repeatable bool
+	// replaces every older version that is not in the collection, set by the
+	// "-- makoto:squash" directive
+	Squash bool
+	// set instead of the statements for Go migrations
+	UpFunc   MigrateFunc
+	DownFunc MigrateFunc
+}
+
+// exectype returns the execution type recorded for running the statement,
+// repeatable scripts are always recorded as ExecREPEAT.
+func (st *MigrateStatement) exectype(exectype string) string {
+	if st.Repeatable {
+		return ExecREPEAT
+	}
+	return exectype
+}
+
+// IsFunc reports whether the migration is written in Go.
+func (st *MigrateStatement) IsFunc() bool {
+	return st.UpFunc != nil || st.DownFunc != nil
+}
+
+// Func returns the up or down function for the execution type.
+func (st *MigrateStatement) Func(exectype string) MigrateFunc {
+	if exectype == ExecDOWN {
+		return st.DownFunc
+	}
+	return st.UpFunc
+}
+
+// Script returns the up or down statement for the execution type, repeatable
+// scripts only have an up statement.
+func (st *MigrateStatement) Script(exectype string) string {
+	if exectype == ExecDOWN {
+		return st.DownStatement
+	}
+	return st.UpStatement
 }
 
 // a simple sorted linkedlist
@@ -62,10 +138,32 @@ func (m *migrationItem) Previous() *migrationItem {
 
 type MigrationCollection struct {
 	head *migrationItem
+	// repeatable migrations sorted by filename, they have no version
+	repeatables []*MigrateStatement
 }
 
 func (m *MigrationCollection) Reset() {
 	m.head = nil
+	m.repeatables = nil
+}
+
+// Repeatables returns the repeatable migrations sorted by filename.
+func (m *MigrationCollection) Repeatables() []*MigrateStatement {
+	return m.repeatables
+}
+
+func (m *MigrationCollection) addRepeatable(st *MigrateStatement) {
+	statement := *st
+	i := sort.Search(len(m.repeatables), func(i int) bool {
+		return m.repeatables[i].Filename >= st.Filename
+	})
+	if i < len(m.repeatables) && m.repeatables[i].Filename == st.Filename {
+		m.repeatables[i] = &statement
+		return
+	}
+	m.repeatables = append(m.repeatables, nil)
+	copy(m.repeatables[i+1:], m.repeatables[i:])
+	m.repeatables[i] = &statement
 }
 
 func (m *MigrationCollection) Head() *migrationItem {
@@ -73,6 +171,11 @@ func (m *MigrationCollection) Head() *migrationItem {
 }
 
 func (m *MigrationCollection) Add(st *MigrateStatement) {
+	if st.Repeatable {
+		m.addRepeatable(st)
+		return
+	}
+
 	newItem := &migrationItem{
 		statement: *st,
 	}
@@ -104,6 +207,28 @@ func (m *MigrationCollection) Add(st *MigrateStatement) {
 	}
 }
 
+// the checksum of a Go migration is the one of its name after this prefix, so
+// its records are told apart from the ones of sql scripts
+const funcChecksumPrefix = "func:"
+
+// AddFunc adds a migration written in Go. It is ordered by version together
+// with the sql scripts and recorded in schema_version under name. A nil down
+// function reverts nothing. A version the collection already has is an
+// ErrDuplicateVersion.
+func (m *MigrationCollection) AddFunc(version int, name string, up, down MigrateFunc) error {
+	if st := m.FindStatement(version); st != nil {
+		return fmt.Errorf("%w: %v in %s and %s", ErrDuplicateVersion, version, st.Filename, name)
+	}
+	m.Add(&MigrateStatement{
+		Version:  version,
+		Filename: name,
+		Checksum: funcChecksumPrefix + getMD5SumString([]byte(name)),
+		UpFunc:   up,
+		DownFunc: down,
+	})
+	return nil
+}
+
 func (m *MigrationCollection) Find(version int) *migrationItem {
 	migration := m.head
 	for {
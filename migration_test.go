@@ -0,0 +1,24 @@
+package makoto
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAddFuncDuplicateVersion(t *testing.T) {
+	collection := &MigrationCollection{}
+	collection.Add(&MigrateStatement{Version: 1, Filename: "1_users.sql"})
+
+	if err := collection.AddFunc(2, "backfill", nil, nil); err != nil {
+		t.Fatalf("AddFunc(2) error = %v", err)
+	}
+	if err := collection.AddFunc(1, "backfill_users", nil, nil); !errors.Is(err, ErrDuplicateVersion) {
+		t.Errorf("AddFunc(1) error = %v, want %v", err, ErrDuplicateVersion)
+	}
+	if err := collection.AddFunc(2, "backfill_again", nil, nil); !errors.Is(err, ErrDuplicateVersion) {
+		t.Errorf("AddFunc(2) error = %v, want %v", err, ErrDuplicateVersion)
+	}
+	if st := collection.FindStatement(1); st.Filename != "1_users.sql" {
+		t.Errorf("FindStatement(1) = %v, want 1_users.sql", st.Filename)
+	}
+}
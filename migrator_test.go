@@ -0,0 +1,112 @@
+package makoto
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestMigrator returns a migrator of the scripts in fsys on an empty
+// SQLite database.
+func newTestMigrator(t *testing.T, fsys fstest.MapFS) (*Migrator, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m := GetMigrator(db, nil)
+	m.SetDialect(SQLite)
+	setTestCollection(t, m, fsys)
+	return m, db
+}
+
+func setTestCollection(t *testing.T, m *Migrator, fsys fstest.MapFS) {
+	t.Helper()
+	collection, err := LoadCollection(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetCollection(collection)
+}
+
+// createTable is a script creating and dropping the table name.
+func createTable(name string) *fstest.MapFile {
+	return script("CREATE TABLE "+name+" (id integer);", "DROP TABLE "+name+";")
+}
+
+func assertApplied(t *testing.T, m *Migrator, want ...int) {
+	t.Helper()
+	records, err := m.Applied()
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := []int{}
+	for _, record := range records {
+		versions = append(versions, record.Version)
+	}
+	if want == nil {
+		want = []int{}
+	}
+	if !reflect.DeepEqual(versions, want) {
+		t.Errorf("applied versions = %v, want %v", versions, want)
+	}
+}
+
+func assertTables(t *testing.T, db *sql.DB, want ...string) {
+	t.Helper()
+	rows, err := db.Query(`SELECT name FROM sqlite_master WHERE type = 'table'
+		AND name NOT LIKE 'sqlite_%' AND name NOT LIKE 'schema_%' ORDER BY name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	tables := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, name)
+	}
+	if want == nil {
+		want = []string{}
+	}
+	if !reflect.DeepEqual(tables, want) {
+		t.Errorf("tables = %v, want %v", tables, want)
+	}
+}
+
+// allRecords returns every schema_version record, none before the first
+// migration created the table.
+func allRecords(t *testing.T, m *Migrator) []MigrationRecord {
+	t.Helper()
+	exists, err := m.dialect.HasTable(context.Background(), m.db, "schema_version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		return nil
+	}
+	records, err := GetAllRecords(m.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+// planned returns the direction and filename of every step.
+func planned(steps []Step) []string {
+	names := []string{}
+	for _, step := range steps {
+		names = append(names, step.Direction+" "+step.Filename)
+	}
+	return names
+}
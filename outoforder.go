@@ -0,0 +1,77 @@
+package makoto
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// SetAllowOutOfOrder lets migrations apply pending scripts older than the
+// latest applied one, e.g. after merging branches. Without it migrating up
+// fails with ErrOutOfOrder.
+func (m *Migrator) SetAllowOutOfOrder(allow bool) {
+	m.outOfOrder = allow
+}
+
+// OutOfOrder returns the scripts older than the latest applied one that were
+// never applied.
+func (m *Migrator) OutOfOrder() ([]*MigrateStatement, error) {
+	return m.OutOfOrderContext(context.Background())
+}
+
+// OutOfOrderContext is like OutOfOrder but runs every database call with ctx.
+func (m *Migrator) OutOfOrderContext(ctx context.Context) ([]*MigrateStatement, error) {
+	collection, err := m.Collection()
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := m.loadHistory(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := []*MigrateStatement{}
+	for _, item := range outOfOrder(collection, h, h.latest()) {
+		statements = append(statements, item.Statement())
+	}
+	return statements, nil
+}
+
+// checkOutOfOrder fails when migrating up to targetVersion would apply out of
+// order scripts and they are not allowed.
+func (m *Migrator) checkOutOfOrder(collection *MigrationCollection, h *history, targetVersion int) error {
+	if m.outOfOrder {
+		return nil
+	}
+
+	latest := h.latest()
+	if targetVersion < latest {
+		latest = targetVersion
+	}
+
+	items := outOfOrder(collection, h, latest)
+	if len(items) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = item.statement.Filename
+	}
+	return fmt.Errorf("%w: %s", ErrOutOfOrder, strings.Join(names, ", "))
+}
+
+// outOfOrder returns the scripts below version that are not applied.
+func outOfOrder(collection *MigrationCollection, h *history, version int) []*migrationItem {
+	items := []*migrationItem{}
+	for item := collection.Head(); item != nil; item = item.Next() {
+		if item.statement.Version >= version {
+			break
+		}
+		if !h.isApplied(item.statement.Version) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,97 @@
+package makoto
+
+import (
+	"context"
+	"errors"
+)
+
+// Step is a script that a migration would run.
+type Step struct {
+	// ExecUP, ExecDOWN or ExecREPEAT
+	Direction     string
+	Version       int
+	Filename      string
+	SQL           string
+	Transactional bool
+	// a Go migration, SQL is empty
+	Func bool
+}
+
+// Plan returns the scripts that migrating to targetVersion would run, in
+// order, without running them. The direction follows the current schema
+// version, like MigrateTo when the database is behind and Rollback when it is
+// ahead, so targetVersion has to be in the collection. PlanDrop plans
+// reverting every applied script.
+func (m *Migrator) Plan(targetVersion int) ([]Step, error) {
+	return m.PlanContext(context.Background(), targetVersion)
+}
+
+// PlanContext is like Plan but runs every database call with ctx.
+func (m *Migrator) PlanContext(ctx context.Context, targetVersion int) ([]Step, error) {
+	items, err := m.planUp(ctx, m.db, targetVersion)
+	if errors.Is(err, ErrDatabaseAhead) {
+		items, err = m.planDown(ctx, m.db, targetVersion, false)
+		if err != nil {
+			return nil, err
+		}
+		return m.toSteps(items, ExecDOWN), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m.toSteps(items, ExecUP), nil
+}
+
+// PlanDrop is like Plan but for the scripts Drop would run.
+func (m *Migrator) PlanDrop() ([]Step, error) {
+	return m.PlanDropContext(context.Background())
+}
+
+// PlanDropContext is like PlanDrop but runs every database call with ctx.
+func (m *Migrator) PlanDropContext(ctx context.Context) ([]Step, error) {
+	items, err := m.planDown(ctx, m.db, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	return m.toSteps(items, ExecDOWN), nil
+}
+
+// PlanHead is like Plan but for the scripts MigrateToHead would run, which
+// include the repeatable scripts of a collection without versioned ones.
+func (m *Migrator) PlanHead() ([]Step, error) {
+	return m.PlanHeadContext(context.Background())
+}
+
+// PlanHeadContext is like PlanHead but runs every database call with ctx.
+func (m *Migrator) PlanHeadContext(ctx context.Context) ([]Step, error) {
+	collection, err := m.Collection()
+	if err != nil {
+		return nil, err
+	}
+
+	targetVersion := 0
+	if lastStatement := collection.LastStatement(); lastStatement != nil {
+		targetVersion = lastStatement.Version
+	}
+	items, err := m.planUp(ctx, m.db, targetVersion)
+	if err != nil {
+		return nil, err
+	}
+	return m.toSteps(items, ExecUP), nil
+}
+
+func (m *Migrator) toSteps(items []*migrationItem, exectype string) []Step {
+	steps := make([]Step, len(items))
+	for i, item := range items {
+		st := item.Statement()
+		steps[i] = Step{
+			Direction:     st.exectype(exectype),
+			Version:       st.Version,
+			Filename:      st.Filename,
+			SQL:           st.Script(exectype),
+			Transactional: st.IsFunc() || m.runsInTx(st),
+			Func:          st.IsFunc(),
+		}
+	}
+	return steps
+}
@@ -0,0 +1,97 @@
+package makoto
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// assertPlanRuns checks that run writes a record for exactly the steps plan
+// returned, in the same order.
+func assertPlanRuns(t *testing.T, m *Migrator, plan func() ([]Step, error), run func() error) {
+	t.Helper()
+	steps, err := plan()
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	before := allRecords(t, m)
+	if err := run(); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	after := allRecords(t, m)
+
+	ran := []string{}
+	for _, record := range after[len(before):] {
+		ran = append(ran, record.Exectype+" "+record.Filename)
+	}
+	if !reflect.DeepEqual(planned(steps), ran) {
+		t.Errorf("planned %v, ran %v", planned(steps), ran)
+	}
+}
+
+func TestPlanMatchesMigrations(t *testing.T) {
+	m, _ := newTestMigrator(t, fstest.MapFS{
+		"1_a.sql": createTable("a"),
+		"2_b.sql": createTable("b"),
+		"3_c.sql": createTable("c"),
+		"R_v.sql": script("DROP VIEW IF EXISTS v; CREATE VIEW v AS SELECT 1;", ""),
+	})
+
+	assertPlanRuns(t, m,
+		func() ([]Step, error) { return m.Plan(2) },
+		func() error { return m.MigrateTo(2) })
+	assertPlanRuns(t, m,
+		func() ([]Step, error) { return m.PlanHead() },
+		m.MigrateToHead)
+	assertPlanRuns(t, m,
+		func() ([]Step, error) { return m.Plan(1) },
+		func() error { return m.Rollback(1) })
+	assertPlanRuns(t, m,
+		func() ([]Step, error) { return m.PlanSteps(1) },
+		func() error { return m.Steps(1) })
+	assertPlanRuns(t, m,
+		func() ([]Step, error) { return m.PlanSteps(-1) },
+		func() error { return m.Steps(-1) })
+	assertPlanRuns(t, m,
+		func() ([]Step, error) { return m.PlanHead() },
+		m.MigrateToHead)
+	assertPlanRuns(t, m,
+		m.PlanDrop,
+		m.Drop)
+	assertApplied(t, m)
+}
+
+func TestPlanVersionZero(t *testing.T) {
+	m, _ := newTestMigrator(t, fstest.MapFS{
+		"1_a.sql": createTable("a"),
+		"3_c.sql": createTable("c"),
+	})
+	if err := m.MigrateToHead(); err != nil {
+		t.Fatal(err)
+	}
+
+	// version 0 is not in the collection, neither plans nor rolls back
+	if _, err := m.Plan(0); !errors.Is(err, ErrTargetVersionNotFound) {
+		t.Errorf("Plan(0) error = %v, want %v", err, ErrTargetVersionNotFound)
+	}
+	if err := m.Rollback(0); !errors.Is(err, ErrTargetVersionNotFound) {
+		t.Errorf("Rollback(0) error = %v, want %v", err, ErrTargetVersionNotFound)
+	}
+	assertApplied(t, m, 1, 3)
+
+	// a script of version 0 is kept by both
+	setTestCollection(t, m, fstest.MapFS{
+		"0_init.sql": createTable("init"),
+		"1_a.sql":    createTable("a"),
+		"3_c.sql":    createTable("c"),
+	})
+	m.SetAllowOutOfOrder(true)
+	if err := m.MigrateTo(3); err != nil {
+		t.Fatal(err)
+	}
+	assertPlanRuns(t, m,
+		func() ([]Step, error) { return m.Plan(0) },
+		func() error { return m.Rollback(0) })
+	assertApplied(t, m, 0)
+}
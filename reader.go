@@ -6,41 +6,139 @@ import (
 	"crypto/md5"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
+	"path"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
 
-func ParseMigrationStatement(fname string, r io.Reader) *MigrateStatement {
-	migration := newStatementFromReader(r)
-	migration.Filename = fname
-	migration.Version = parseFilenameVersion(fname)
+const (
+	// header directive for scripts that cannot run inside a transaction,
+	// e.g. CREATE INDEX CONCURRENTLY
+	directiveNoTransaction = "-- makoto:no-transaction"
+	// header directive for seeds that run every time
+	directiveRepeatable = "-- makoto:repeatable"
+	// header directive of a script written by makoto squash
+	directiveSquash = "-- makoto:squash"
+
+	// filename prefix of repeatable migrations
+	repeatablePrefix = "R_"
+
+	sqlFileExtension = ".sql"
+)
 
+var filenameVersionRegexp = regexp.MustCompile("[0-9]+_")
+
+// Deprecated: use ReadMigrationStatement, which returns an error instead of
+// terminating the process.
+func ParseMigrationStatement(fname string, r io.Reader) *MigrateStatement {
+	migration, err := ReadMigrationStatement(fname, r)
+	if err != nil {
+		log.Fatal(err)
+	}
 	return migration
 }
 
-func parseFilenameVersion(filename string) int {
-	r, err := regexp.Compile("[0-9]+_")
+// LoadCollection reads the sql scripts in dir of fsys and its subdirectories
+// into a collection, e.g. from os.DirFS, an embed.FS or a fstest.MapFS. Files
+// without the .sql extension are ignored, scripts are named by their path
+// relative to dir. Two scripts with the same version are an error.
+func LoadCollection(fsys fs.FS, dir string) (*MigrationCollection, error) {
+	names, err := sqlFilenames(fsys, dir)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+
+	collection := &MigrationCollection{}
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		statement, err := ReadMigrationStatement(name, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if !statement.Repeatable {
+			if st := collection.FindStatement(statement.Version); st != nil {
+				return nil, fmt.Errorf("%w: %v in %s and %s", ErrDuplicateVersion, statement.Version, st.Filename, name)
+			}
+		}
+		collection.Add(statement)
 	}
+	return collection, nil
+}
 
-	st := r.FindString(filename)
+// sqlFilenames returns the path relative to dir of every sql file in dir and
+// its subdirectories, sorted.
+func sqlFilenames(fsys fs.FS, dir string) ([]string, error) {
+	names := []string{}
+	err := fs.WalkDir(fsys, dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || path.Ext(p) != sqlFileExtension {
+			return nil
+		}
+		name := p
+		if dir != "." {
+			name = strings.TrimPrefix(p, dir+"/")
+		}
+		names = append(names, name)
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+// ReadMigrationStatement reads a versioned script named [version]_[name].sql or
+// a repeatable script named R_[name].sql.
+func ReadMigrationStatement(fname string, r io.Reader) (*MigrateStatement, error) {
+	repeatable := strings.HasPrefix(path.Base(fname), repeatablePrefix)
+
+	version := 0
+	if !repeatable {
+		var err error
+		version, err = parseFilenameVersion(fname)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	migration, err := newStatementFromReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", fname, err)
+	}
+	migration.Filename = fname
+	migration.Version = version
+	// only the filename makes a migration repeatable, the directive is for seeds
+	migration.Repeatable = repeatable
+
+	return migration, nil
+}
+
+// parseFilenameVersion parses the version of the file name, not of the
+// directories it is in.
+func parseFilenameVersion(filename string) (int, error) {
+	st := filenameVersionRegexp.FindString(path.Base(filename))
 	if st == "" {
-		log.Fatal("Invalid file, empty version number")
+		return 0, fmt.Errorf("%w: %s: empty version number", ErrInvalidFilename, filename)
 	}
 	st = st[:len(st)-1]
 	v, err := strconv.Atoi(st)
 	if err != nil {
-		log.Fatal(err)
+		return 0, fmt.Errorf("%w: %s: %v", ErrInvalidFilename, filename, err)
 	}
-	return v
+	return v, nil
 }
 
-func newStatementFromReader(r io.Reader) *MigrateStatement {
+func newStatementFromReader(r io.Reader) (*MigrateStatement, error) {
 	var buf bytes.Buffer
 	isDown := false
+	isHeader := true
 
 	migration := MigrateStatement{}
 	scanner := bufio.NewScanner(r)
@@ -51,6 +149,20 @@ func newStatementFromReader(r io.Reader) *MigrateStatement {
 
 		buf.WriteString(line)
 
+		trimmed := strings.TrimSpace(line)
+		if isHeader && trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+			isHeader = false
+		}
+		if isHeader && trimmed == directiveNoTransaction {
+			migration.NoTransaction = true
+		}
+		if isHeader && trimmed == directiveRepeatable {
+			migration.Repeatable = true
+		}
+		if isHeader && trimmed == directiveSquash {
+			migration.Squash = true
+		}
+
 		if strings.HasPrefix(line, "-- Down") {
 			isDown = true
 			continue
@@ -66,10 +178,13 @@ func newStatementFromReader(r io.Reader) *MigrateStatement {
 			migration.UpStatement += line + "\n"
 		}
 	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
 
 	migration.Checksum = getMD5SumString(buf.Bytes())
 
-	return &migration
+	return &migration, nil
 }
 
 func getMD5SumString(b []byte) string {
@@ -0,0 +1,135 @@
+package makoto
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func script(up, down string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte("-- Up\n" + up + "\n-- Down\n" + down + "\n")}
+}
+
+func TestLoadCollection(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/1_users.sql":          script("CREATE TABLE users ();", "DROP TABLE users;"),
+		"sql/2022/3_orders.sql":    script("CREATE TABLE orders ();", "DROP TABLE orders;"),
+		"sql/2022/q1/2_items.sql":  script("CREATE TABLE items ();", "DROP TABLE items;"),
+		"sql/views/R_users.sql":    script("CREATE VIEW v AS SELECT 1;", ""),
+		"sql/README.md":            &fstest.MapFile{Data: []byte("not a script")},
+		"other/4_ignored.sql":      script("", ""),
+		"sql/2022/q1/notes.sql.gz": &fstest.MapFile{Data: []byte{}},
+	}
+
+	collection, err := LoadCollection(fsys, "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filenames := []string{}
+	for item := collection.Head(); item != nil; item = item.Next() {
+		filenames = append(filenames, item.Statement().Filename)
+	}
+	want := []string{"1_users.sql", "2022/q1/2_items.sql", "2022/3_orders.sql"}
+	if !reflect.DeepEqual(filenames, want) {
+		t.Errorf("versioned scripts = %v, want %v", filenames, want)
+	}
+
+	repeatables := collection.Repeatables()
+	if len(repeatables) != 1 || repeatables[0].Filename != "views/R_users.sql" {
+		t.Errorf("repeatables = %v, want views/R_users.sql", repeatables)
+	}
+
+	st := collection.FindStatement(3)
+	if st == nil || st.UpStatement != "CREATE TABLE orders ();\n" || st.DownStatement != "DROP TABLE orders;\n" {
+		t.Errorf("FindStatement(3) = %+v", st)
+	}
+}
+
+func TestLoadCollectionRoot(t *testing.T) {
+	fsys := fstest.MapFS{
+		"1_users.sql":     script("", ""),
+		"nested/2_a.sql":  script("", ""),
+		"R_functions.sql": script("", ""),
+	}
+
+	collection, err := LoadCollection(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := collection.FindStatement(2); st == nil || st.Filename != "nested/2_a.sql" {
+		t.Errorf("FindStatement(2) = %+v, want nested/2_a.sql", st)
+	}
+	if len(collection.Repeatables()) != 1 {
+		t.Errorf("repeatables = %v, want R_functions.sql", collection.Repeatables())
+	}
+}
+
+func TestLoadCollectionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		err  error
+	}{
+		{
+			name: "duplicate version",
+			fsys: fstest.MapFS{
+				"sql/1_users.sql":  script("", ""),
+				"sql/1_orders.sql": script("", ""),
+			},
+			err: ErrDuplicateVersion,
+		},
+		{
+			name: "duplicate version across subdirectories",
+			fsys: fstest.MapFS{
+				"sql/2022/1_users.sql":  script("", ""),
+				"sql/2023/1_orders.sql": script("", ""),
+			},
+			err: ErrDuplicateVersion,
+		},
+		{
+			name: "invalid filename",
+			fsys: fstest.MapFS{
+				"sql/users.sql": script("", ""),
+			},
+			err: ErrInvalidFilename,
+		},
+		{
+			name: "missing directory",
+			fsys: fstest.MapFS{
+				"migration/1_users.sql": script("", ""),
+			},
+			err: fs.ErrNotExist,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadCollection(tt.fsys, "sql")
+			if !errors.Is(err, tt.err) {
+				t.Errorf("LoadCollection() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadCollectionRepeatablesShareVersion(t *testing.T) {
+	// repeatable scripts have no version and never collide
+	fsys := fstest.MapFS{
+		"sql/R_a.sql":      script("", ""),
+		"sql/sub/R_b.sql":  script("", ""),
+		"sql/0_init.sql":   script("", ""),
+		"sql/sub/1_x.sql":  script("", ""),
+		"sql/sub/R_00.sql": script("", ""),
+	}
+
+	collection, err := LoadCollection(fsys, "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(collection.Repeatables()); got != 3 {
+		t.Errorf("repeatables = %v, want 3", got)
+	}
+}
@@ -0,0 +1,73 @@
+package makoto
+
+import (
+	"context"
+	"database/sql"
+	"log"
+)
+
+// Redo reverts the latest n applied scripts and applies them again. The down
+// and up scripts share one transaction unless a script has the no-transaction
+// directive, the transaction mode is TxModeNone or the dialect runs every
+// script on its own.
+func (m *Migrator) Redo(n int) error {
+	return m.RedoContext(context.Background(), n)
+}
+
+// RedoContext is like Redo but runs every database call with ctx.
+func (m *Migrator) RedoContext(ctx context.Context, n int) error {
+	return m.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		return m.redo(ctx, conn, n)
+	})
+}
+
+func (m *Migrator) redo(ctx context.Context, conn *sql.Conn, n int) error {
+	if n <= 0 {
+		return nil
+	}
+
+	targetVersion, err := m.stepTarget(ctx, conn, n)
+	if err != nil {
+		return err
+	}
+
+	downItems, err := m.planDown(ctx, conn, targetVersion, targetVersion == 0)
+	if err != nil {
+		return err
+	}
+	if len(downItems) == 0 {
+		log.Println("No migration to redo")
+		return nil
+	}
+
+	upItems := make([]*migrationItem, len(downItems))
+	for i, item := range downItems {
+		upItems[len(downItems)-1-i] = item
+	}
+
+	if !m.canRunInTx(downItems) {
+		if err := m.execute(ctx, conn, downItems, ExecDOWN); err != nil {
+			return err
+		}
+		return m.execute(ctx, conn, upItems, ExecUP)
+	}
+
+	return m.runInTx(ctx, conn, func(tx *sql.Tx) error {
+		if err := m.runScripts(ctx, tx, downItems, ExecDOWN); err != nil {
+			return err
+		}
+		return m.runScripts(ctx, tx, upItems, ExecUP)
+	})
+}
+
+func (m *Migrator) canRunInTx(items []*migrationItem) bool {
+	if single, ok := m.dialect.(SingleScriptTx); ok && single.SingleScriptTx() {
+		return false
+	}
+	for _, item := range items {
+		if !m.runsInTx(item.Statement()) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package makoto
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// lastExectypes returns the exectype and filename of the latest n records.
+func lastExectypes(t *testing.T, m *Migrator, n int) []string {
+	t.Helper()
+	records := allRecords(t, m)
+	names := []string{}
+	for _, record := range records[len(records)-n:] {
+		names = append(names, record.Exectype+" "+record.Filename+" "+record.Status)
+	}
+	return names
+}
+
+func TestRedo(t *testing.T) {
+	for _, mode := range []TxMode{TxModeAll, TxModeNone} {
+		t.Run(string(mode), func(t *testing.T) {
+			m, db := newTestMigrator(t, fstest.MapFS{
+				"1_a.sql": createTable("a"),
+				"2_b.sql": createTable("b"),
+			})
+			m.SetTxMode(mode)
+			if err := m.MigrateToHead(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := m.Redo(1); err != nil {
+				t.Fatal(err)
+			}
+			assertApplied(t, m, 1, 2)
+			assertTables(t, db, "a", "b")
+			want := []string{"down 2_b.sql succeeded", "up 2_b.sql succeeded"}
+			if got := lastExectypes(t, m, 2); !reflect.DeepEqual(got, want) {
+				t.Errorf("records = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRedoFailure(t *testing.T) {
+	tests := []struct {
+		mode   TxMode
+		tables []string
+		dirty  bool
+	}{
+		// the down script rolls back with the failing up script
+		{TxModeAll, []string{"a", "b"}, false},
+		// the down script stays applied and the up script leaves the
+		// database dirty
+		{TxModeNone, []string{"a"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			m, db := newTestMigrator(t, fstest.MapFS{
+				"1_a.sql": createTable("a"),
+				"2_b.sql": createTable("b"),
+			})
+			m.SetTxMode(tt.mode)
+			if err := m.MigrateToHead(); err != nil {
+				t.Fatal(err)
+			}
+
+			// the edited script fails to apply again
+			setTestCollection(t, m, fstest.MapFS{
+				"1_a.sql": createTable("a"),
+				"2_b.sql": script("INSERT INTO missing VALUES (1);", "DROP TABLE b;"),
+			})
+			m.SetIgnoreDrift(true)
+
+			var migrationErr *MigrationError
+			if err := m.Redo(1); !errors.As(err, &migrationErr) || migrationErr.Exectype != ExecUP {
+				t.Fatalf("Redo(1) error = %v, want a MigrationError of the up script", err)
+			}
+			assertTables(t, db, tt.tables...)
+
+			status, err := m.Status()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.Dirty != tt.dirty {
+				t.Errorf("Status().Dirty = %v, want %v", status.Dirty, tt.dirty)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package makoto
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"log"
+	"path"
+)
+
+// placeholders are rebound to the dialect
+const (
+	_sqlFindSeed = `
+SELECT count(*) FROM schema_seed WHERE env = ? AND filename = ?
+`
+	_sqlSaveSeed = `
+INSERT INTO schema_seed (env, filename, checksum) VALUES (?, ?, ?)
+`
+)
+
+// Seed runs the sql scripts in the env directory of fsys and its
+// subdirectories in path order, e.g. dev/*.sql. Every seed runs once per env and is recorded in the
+// schema_seed table, seeds with the "-- makoto:repeatable" directive run every
+// time.
+func (m *Migrator) Seed(ctx context.Context, fsys fs.FS, env string) error {
+	seeds, err := readSeeds(fsys, env)
+	if err != nil {
+		return err
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		if err := execAll(ctx, conn, m.dialect.SeedTable()); err != nil {
+			return err
+		}
+
+		for _, seed := range seeds {
+			if err := m.runSeed(ctx, conn, env, seed); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Migrator) runSeed(ctx context.Context, conn *sql.Conn, env string, seed *MigrateStatement) error {
+	if !seed.Repeatable {
+		var count int
+		if err := conn.QueryRowContext(ctx, rebind(m.dialect, _sqlFindSeed), env, seed.Filename).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+	}
+
+	run := func(db Executor) error {
+		if _, err := db.ExecContext(ctx, seed.UpStatement); err != nil {
+			return &MigrationError{seed.Version, seed.Filename, ExecUP, err}
+		}
+		_, err := db.ExecContext(ctx, rebind(m.dialect, _sqlSaveSeed), env, seed.Filename, seed.Checksum)
+		return err
+	}
+
+	var err error
+	if seed.NoTransaction || !m.dialect.TransactionalDDL() {
+		err = run(conn)
+	} else {
+		err = m.runInTx(ctx, conn, func(tx *sql.Tx) error {
+			return run(tx)
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Println("Seed script: ", seed.Filename)
+	return nil
+}
+
+func readSeeds(fsys fs.FS, env string) ([]*MigrateStatement, error) {
+	names, err := sqlFilenames(fsys, env)
+	if err != nil {
+		return nil, err
+	}
+
+	seeds := []*MigrateStatement{}
+	for _, name := range names {
+		f, err := fsys.Open(path.Join(env, name))
+		if err != nil {
+			return nil, err
+		}
+		seed, err := newStatementFromReader(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		seed.Filename = name
+		seeds = append(seeds, seed)
+	}
+	return seeds, nil
+}
@@ -0,0 +1,120 @@
+package makoto
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// MigrationStatus is the state of a single migration version.
+type MigrationStatus struct {
+	Version  int
+	Filename string
+	Applied  bool
+	// zero when the migration is not applied
+	AppliedAt time.Time
+	// false when the applied script was edited afterwards
+	ChecksumMatch bool
+	// applied but the script no longer exists
+	Missing bool
+	// a repeatable script without version, applied when it ran before
+	Repeatable bool
+}
+
+// SchemaStatus lists every migration known to the collection or the
+// schema_version history, ordered by version with the repeatable scripts last.
+type SchemaStatus struct {
+	// the latest applied version, 0 when nothing is applied
+	Version    int
+	Dirty      bool
+	Migrations []MigrationStatus
+}
+
+// Pending returns the migrations that are not applied yet and the repeatable
+// scripts that changed since they last ran.
+func (s *SchemaStatus) Pending() []MigrationStatus {
+	pending := []MigrationStatus{}
+	for _, ms := range s.Migrations {
+		if !ms.Applied || (ms.Repeatable && !ms.ChecksumMatch) {
+			pending = append(pending, ms)
+		}
+	}
+	return pending
+}
+
+// Status returns the state of every migration, applied or pending.
+func (m *Migrator) Status() (*SchemaStatus, error) {
+	return m.StatusContext(context.Background())
+}
+
+// StatusContext is like Status but runs every database call with ctx.
+func (m *Migrator) StatusContext(ctx context.Context) (*SchemaStatus, error) {
+	collection, err := m.Collection()
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := m.loadHistory(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &SchemaStatus{
+		Version:    h.latest(),
+		Migrations: []MigrationStatus{},
+	}
+
+	last, err := m.lastRecord(ctx, m.db)
+	if err != nil && err != ErrRecordNotFound {
+		return nil, err
+	}
+	status.Dirty = last != nil && last.Dirty()
+
+	for item := collection.Head(); item != nil; item = item.Next() {
+		st := item.Statement()
+		ms := MigrationStatus{
+			Version:       st.Version,
+			Filename:      st.Filename,
+			ChecksumMatch: true,
+		}
+		if record, ok := h.record(st.Version); ok {
+			ms.Applied = true
+			ms.AppliedAt = record.CreatedAt
+			ms.ChecksumMatch = record.Checksum == st.Checksum
+		}
+		status.Migrations = append(status.Migrations, ms)
+	}
+
+	for _, record := range h.records() {
+		if collection.Find(record.Version) != nil {
+			continue
+		}
+		status.Migrations = append(status.Migrations, MigrationStatus{
+			Version:       record.Version,
+			Filename:      record.Filename,
+			Applied:       true,
+			AppliedAt:     record.CreatedAt,
+			ChecksumMatch: true,
+			Missing:       !record.IsFunc(),
+		})
+	}
+
+	sort.Slice(status.Migrations, func(i, j int) bool {
+		return status.Migrations[i].Version < status.Migrations[j].Version
+	})
+
+	for _, st := range collection.Repeatables() {
+		ms := MigrationStatus{
+			Filename:      st.Filename,
+			ChecksumMatch: true,
+			Repeatable:    true,
+		}
+		if record, ok := h.repeatRecord(st.Filename); ok {
+			ms.Applied = true
+			ms.AppliedAt = record.CreatedAt
+			ms.ChecksumMatch = record.Checksum == st.Checksum
+		}
+		status.Migrations = append(status.Migrations, ms)
+	}
+	return status, nil
+}
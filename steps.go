@@ -0,0 +1,129 @@
+package makoto
+
+import (
+	"context"
+	"database/sql"
+	"log"
+)
+
+// Steps applies the next n pending scripts in version order, or reverts the
+// latest -n applied scripts when n is negative. It stops when there are fewer
+// than n scripts to run.
+func (m *Migrator) Steps(n int) error {
+	return m.StepsContext(context.Background(), n)
+}
+
+// StepsContext is like Steps but runs every database call with ctx.
+func (m *Migrator) StepsContext(ctx context.Context, n int) error {
+	return m.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		switch {
+		case n == 0:
+			return nil
+		case n > 0:
+			items, err := m.planUpSteps(ctx, conn, n)
+			if err != nil {
+				return err
+			}
+			if len(items) == 0 {
+				log.Println("Schema version is already up to date")
+				return nil
+			}
+			log.Println("Start migration")
+			return m.execute(ctx, conn, items, ExecUP)
+		}
+
+		targetVersion, err := m.stepTarget(ctx, conn, -n)
+		if err != nil {
+			return err
+		}
+		if targetVersion == 0 {
+			return m.dropAll(ctx, conn)
+		}
+		return m.down(ctx, conn, targetVersion)
+	})
+}
+
+// PlanSteps is like Plan but for the scripts Steps(n) would run.
+func (m *Migrator) PlanSteps(n int) ([]Step, error) {
+	return m.PlanStepsContext(context.Background(), n)
+}
+
+// PlanStepsContext is like PlanSteps but runs every database call with ctx.
+func (m *Migrator) PlanStepsContext(ctx context.Context, n int) ([]Step, error) {
+	switch {
+	case n == 0:
+		return []Step{}, nil
+	case n > 0:
+		items, err := m.planUpSteps(ctx, m.db, n)
+		if err != nil {
+			return nil, err
+		}
+		return m.toSteps(items, ExecUP), nil
+	}
+
+	targetVersion, err := m.stepTarget(ctx, m.db, -n)
+	if err != nil {
+		return nil, err
+	}
+	items, err := m.planDown(ctx, m.db, targetVersion, targetVersion == 0)
+	if err != nil {
+		return nil, err
+	}
+	return m.toSteps(items, ExecDOWN), nil
+}
+
+// planUpSteps returns the next n scripts that migrating to the head would
+// run, scripts skipped out of order included. The repeatable scripts follow
+// once no versioned script is left.
+func (m *Migrator) planUpSteps(ctx context.Context, db Executor, n int) ([]*migrationItem, error) {
+	if err := m.checkState(ctx, db); err != nil {
+		return nil, err
+	}
+
+	collection, err := m.Collection()
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := m.loadHistory(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	headVersion := 0
+	if lastStatement := collection.LastStatement(); lastStatement != nil {
+		headVersion = lastStatement.Version
+	}
+	pending := upTo(collection, h, headVersion)
+	if n >= len(pending) {
+		n = len(pending)
+	}
+	items := pending[:n]
+	if len(items) == 0 {
+		return items, nil
+	}
+
+	// scripts skipped out of order come first in pending
+	if err := m.checkOutOfOrder(collection, h, headVersion); err != nil {
+		return nil, err
+	}
+	if n == len(pending) {
+		items = append(items, repeatables(collection, h)...)
+	}
+	return items, nil
+}
+
+// stepTarget returns the version n scripts below the latest applied version,
+// 0 when stepping down past the first applied script.
+func (m *Migrator) stepTarget(ctx context.Context, db Executor, n int) (int, error) {
+	h, err := m.loadHistory(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+
+	versions := h.versions()
+	if n >= len(versions) {
+		return 0, nil
+	}
+	return versions[len(versions)-1-n], nil
+}
@@ -0,0 +1,89 @@
+package makoto
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStepsOutOfOrder(t *testing.T) {
+	m, db := newTestMigrator(t, fstest.MapFS{
+		"1_a.sql": createTable("a"),
+		"3_c.sql": createTable("c"),
+	})
+	if err := m.MigrateToHead(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 2_b.sql was merged after 3_c.sql was applied
+	setTestCollection(t, m, fstest.MapFS{
+		"1_a.sql": createTable("a"),
+		"2_b.sql": createTable("b"),
+		"3_c.sql": createTable("c"),
+		"4_d.sql": createTable("d"),
+	})
+
+	if err := m.Steps(1); !errors.Is(err, ErrOutOfOrder) {
+		t.Fatalf("Steps(1) error = %v, want %v", err, ErrOutOfOrder)
+	}
+
+	m.SetAllowOutOfOrder(true)
+	steps, err := m.PlanSteps(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"up 2_b.sql"}; !reflect.DeepEqual(planned(steps), want) {
+		t.Errorf("PlanSteps(1) = %v, want %v", planned(steps), want)
+	}
+	if err := m.Steps(1); err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, m, 1, 2, 3)
+	assertTables(t, db, "a", "b", "c")
+
+	if err := m.Steps(1); err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, m, 1, 2, 3, 4)
+}
+
+func TestStepsWithGaps(t *testing.T) {
+	m, db := newTestMigrator(t, fstest.MapFS{
+		"1_a.sql": createTable("a"),
+		"3_c.sql": createTable("c"),
+	})
+	if err := m.MigrateToHead(); err != nil {
+		t.Fatal(err)
+	}
+	setTestCollection(t, m, fstest.MapFS{
+		"1_a.sql": createTable("a"),
+		"2_b.sql": createTable("b"),
+		"3_c.sql": createTable("c"),
+		"4_d.sql": createTable("d"),
+	})
+	m.SetAllowOutOfOrder(true)
+
+	steps := []struct {
+		n       int
+		applied []int
+		tables  []string
+	}{
+		// the latest applied script, not the gap below it
+		{-1, []int{1}, []string{"a"}},
+		{2, []int{1, 2, 3}, []string{"a", "b", "c"}},
+		{0, []int{1, 2, 3}, []string{"a", "b", "c"}},
+		{5, []int{1, 2, 3, 4}, []string{"a", "b", "c", "d"}},
+		{1, []int{1, 2, 3, 4}, []string{"a", "b", "c", "d"}},
+		{-2, []int{1, 2}, []string{"a", "b"}},
+		{-10, nil, nil},
+		{-1, nil, nil},
+	}
+	for _, step := range steps {
+		if err := m.Steps(step.n); err != nil {
+			t.Fatalf("Steps(%v): %v", step.n, err)
+		}
+		assertApplied(t, m, step.applied...)
+		assertTables(t, db, step.tables...)
+	}
+}
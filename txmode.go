@@ -0,0 +1,35 @@
+package makoto
+
+import "fmt"
+
+// TxMode controls how pending scripts are grouped into transactions.
+type TxMode string
+
+const (
+	// all pending scripts run in one transaction, a failure rolls back the
+	// whole run
+	TxModeAll TxMode = "all"
+	// every script commits together with its schema_version record, a
+	// failure keeps the scripts that ran before it
+	TxModeEach TxMode = "each"
+	// no transaction at all, every script is recorded as started before it
+	// runs, a failure leaves the failing script partially applied and
+	// recorded as failed, the database is dirty and migrations refuse to run
+	// until Force
+	TxModeNone TxMode = "none"
+)
+
+func ParseTxMode(s string) (TxMode, error) {
+	switch mode := TxMode(s); mode {
+	case TxModeAll, TxModeEach, TxModeNone:
+		return mode, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidTxMode, s)
+}
+
+// SetTxMode sets how scripts are grouped into transactions, the default is
+// TxModeAll. Scripts with the no-transaction directive never run in a
+// transaction.
+func (m *Migrator) SetTxMode(mode TxMode) {
+	m.txMode = mode
+}
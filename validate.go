@@ -0,0 +1,136 @@
+package makoto
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type DriftKind string
+
+const (
+	// an applied migration whose script was edited afterwards
+	DriftChecksumMismatch DriftKind = "checksum mismatch"
+	// an applied migration whose script no longer exists
+	DriftMissingFile DriftKind = "missing file"
+	// a script older than the latest applied migration that was never applied
+	DriftSkipped DriftKind = "skipped"
+	// a squashed script whose replaced versions were only partly applied
+	DriftPartialSquash DriftKind = "partially squashed"
+)
+
+// Drift is a difference between the schema_version history and the
+// migration collection.
+type Drift struct {
+	Kind     DriftKind
+	Version  int
+	Filename string
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%v %s: %s", d.Version, d.Filename, d.Kind)
+}
+
+// DriftError is returned by migrations when the database has drifted from
+// the migration collection.
+type DriftError struct {
+	Drifts []Drift
+}
+
+func (e *DriftError) Error() string {
+	lines := make([]string, len(e.Drifts))
+	for i, d := range e.Drifts {
+		lines[i] = d.String()
+	}
+	return fmt.Sprintf("schema drift detected: %s", strings.Join(lines, "; "))
+}
+
+// SetIgnoreDrift allows migrations to run even when Validate reports drift.
+func (m *Migrator) SetIgnoreDrift(ignore bool) {
+	m.ignoreDrift = ignore
+}
+
+// Validate compares the applied migrations with the collection and reports
+// edited, missing and skipped scripts.
+func (m *Migrator) Validate() ([]Drift, error) {
+	return m.ValidateContext(context.Background())
+}
+
+// ValidateContext is like Validate but runs every database call with ctx.
+func (m *Migrator) ValidateContext(ctx context.Context) ([]Drift, error) {
+	return m.validate(ctx, m.db)
+}
+
+func (m *Migrator) validate(ctx context.Context, db Executor) ([]Drift, error) {
+	collection, err := m.Collection()
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := m.loadHistory(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return findDrift(collection, h), nil
+}
+
+// checkDrift refuses to continue on drift unless it is explicitly ignored.
+func (m *Migrator) checkDrift(ctx context.Context, db Executor) error {
+	if m.ignoreDrift {
+		return nil
+	}
+
+	drifts, err := m.validate(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	// skipped scripts are pending out of order, migrations handle them
+	changed := []Drift{}
+	for _, d := range drifts {
+		if d.Kind != DriftSkipped {
+			changed = append(changed, d)
+		}
+	}
+	if len(changed) > 0 {
+		return &DriftError{Drifts: changed}
+	}
+	return nil
+}
+
+func findDrift(collection *MigrationCollection, h *history) []Drift {
+	drifts := []Drift{}
+
+	for _, record := range h.records() {
+		version := record.Version
+		st := collection.FindStatement(version)
+		if st == nil {
+			// the CLI only reads the sql scripts, Go migrations exist in the
+			// code of the service that applied them
+			if !record.IsFunc() {
+				drifts = append(drifts, Drift{DriftMissingFile, version, record.Filename})
+			}
+			continue
+		}
+		if st.Checksum != record.Checksum {
+			drifts = append(drifts, Drift{DriftChecksumMismatch, version, st.Filename})
+		}
+	}
+
+	for _, version := range h.partial {
+		st := collection.FindStatement(version)
+		drifts = append(drifts, Drift{DriftPartialSquash, version, st.Filename})
+	}
+
+	for _, item := range outOfOrder(collection, h, h.latest()) {
+		st := item.Statement()
+		drifts = append(drifts, Drift{DriftSkipped, st.Version, st.Filename})
+	}
+
+	sort.Slice(drifts, func(i, j int) bool {
+		return drifts[i].Version < drifts[j].Version
+	})
+	return drifts
+}
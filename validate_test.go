@@ -0,0 +1,29 @@
+package makoto
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindDriftGoMigrations(t *testing.T) {
+	// the collection of the CLI has the sql scripts only
+	collection := &MigrationCollection{}
+	collection.Add(&MigrateStatement{Version: 1, Filename: "1_users.sql", Checksum: "a"})
+
+	funcs := &MigrationCollection{}
+	if err := funcs.AddFunc(2, "backfill", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	st := funcs.FindStatement(2)
+
+	h := newHistory([]MigrationRecord{
+		{Version: 1, Filename: "1_users.sql", Checksum: "a", Exectype: ExecUP, Status: StatusSucceeded},
+		{Version: 2, Filename: st.Filename, Checksum: st.Checksum, Exectype: ExecUP, Status: StatusSucceeded},
+		{Version: 3, Filename: "3_removed.sql", Checksum: "c", Exectype: ExecUP, Status: StatusSucceeded},
+	}, collection)
+
+	want := []Drift{{DriftMissingFile, 3, "3_removed.sql"}}
+	if got := findDrift(collection, h); !reflect.DeepEqual(got, want) {
+		t.Errorf("findDrift() = %v, want %v", got, want)
+	}
+}